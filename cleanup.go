@@ -0,0 +1,49 @@
+package ettt
+
+import "fmt"
+
+/*
+cleanup
+クリーンアップスタックの要素.
+*/
+type cleanup struct {
+	name string
+	fn   func() error
+}
+
+/*
+Cleanup
+シナリオ終了時に実行する後片付け処理を登録する.
+登録された処理はTearDownの後に、登録と逆順（LIFO）で必ず実行される.
+例えばCommandが作成したリソースの削除処理を、作成直後に登録することを想定している.
+*/
+func (sc *ScenarioContext) Cleanup(name string, fn func() error) {
+	sc.cleanups = append(sc.cleanups, cleanup{name: name, fn: fn})
+}
+
+/*
+runCleanups
+クリーンアップスタックを逆順に実行する.
+エラーやpanicが発生しても残りの処理は継続し、エラーはTearDownのPhaseErrorとして保持する.
+*/
+func (sc *ScenarioContext) runCleanups() {
+	sc.phase = ScenarioPhaseTearDown
+	for i := len(sc.cleanups) - 1; i >= 0; i-- {
+		c := sc.cleanups[i]
+		sc.Logger().Info("start cleanup.", "name", c.name)
+		if err := callCleanup(c.fn); err != nil {
+			sc.Logger().Warn("error cleanup.", "name", c.name, "error", err)
+			sc.addPhaseError(ScenarioPhaseTearDown, fmt.Errorf("cleanup %s: %w", c.name, err))
+		}
+	}
+	sc.cleanups = nil
+}
+
+/*
+callCleanup
+クリーンアップ処理を実行し、panicをPanicErrorに変換する.
+*/
+func callCleanup(fn func() error) (err error) {
+	defer recoverPanic(&err)
+	return fn()
+}
@@ -0,0 +1,243 @@
+/*
+Package cli
+レジストリに登録されたシナリオを実行するコマンドラインランナー.
+
+利用側はシナリオパッケージをブランクインポートしたmainから Run を呼び出す.
+
+	import (
+		"os"
+
+		"github.com/easy-to-test-tool/ettt/cli"
+		_ "example.com/project/scenarios"
+	)
+
+	func main() {
+		os.Exit(cli.Run(os.Args[1:], os.Stdout))
+	}
+*/
+package cli
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/easy-to-test-tool/ettt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+/*
+Run
+引数を解析してシナリオを実行し、終了コードを返却する.
+*/
+func Run(args []string, stdout io.Writer, extensions ...ettt.ExtensionContext) int {
+	fs := flag.NewFlagSet("ettt", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	var (
+		options  ettt.Options
+		runExpr  string
+		skipExpr string
+		list     bool
+	)
+	fs.StringVar(&options.Profile, "profile", ettt.ProfileDefault, "profile names separated by comma. later profiles override earlier ones")
+	fs.StringVar(&options.ProfilePath, "profile-path", ettt.ProfilePathDefault, "profile directory path")
+	overrides := keyValueFlag{}
+	fs.Var(overrides, "set", "override profile variable as key=value (repeatable)")
+	fs.StringVar(&options.SecretKeyFile, "secret-key-file", "", "key file to decrypt encrypted profile variables")
+	var encrypt string
+	var generateKey bool
+	fs.StringVar(&encrypt, "encrypt", "", "print the value encrypted with --secret-key-file and exit")
+	fs.BoolVar(&generateKey, "generate-key", false, "print a new secret key and exit")
+	fs.StringVar(&options.ResultPath, "result", ettt.DefaultResultPath, "result root directory path")
+	fs.StringVar(&options.TemplateDirPath, "template-dir", "", "custom report template directory path")
+	fs.IntVar(&options.MaxConcurrency, "parallel", 1, "maximum number of scenarios run concurrently")
+	fs.DurationVar(&options.PhaseTimeout, "phase-timeout", 0, "timeout of each scenario phase (0 means no timeout)")
+	var replaceMode string
+	fs.StringVar(&replaceMode, "replace-mode", string(ettt.ReplaceStrict), "how to handle unresolved variables (strict or lenient)")
+	var retryDelay time.Duration
+	var retryBackoff string
+	fs.IntVar(&options.CommandRetry.MaxAttempts, "retry", 1, "maximum attempts of each command (1 means no retry)")
+	fs.IntVar(&options.ScenarioRetry.MaxAttempts, "scenario-retry", 1, "maximum attempts of each scenario (1 means no retry)")
+	fs.DurationVar(&retryDelay, "retry-delay", 0, "delay before the first retry")
+	fs.StringVar(&retryBackoff, "retry-backoff", string(ettt.BackoffConstant), "backoff strategy of retry delay (constant, linear or exponential)")
+	fs.StringVar(&runExpr, "run", "", "run only scenarios whose name matches the regular expression")
+	fs.StringVar(&skipExpr, "skip", "", "skip scenarios whose name matches the regular expression")
+	fs.StringVar(&options.TagExpression, "tags", "", "run only scenarios whose tags match the expression (e.g. \"smoke && !slow\")")
+	fs.BoolVar(&list, "list", false, "list scenarios and exit")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ettt.ExitCodeNormal
+		}
+		return ettt.ExitCodeUsageError
+	}
+
+	options.ProfileOverrides = overrides
+	switch options.ReplaceMode = ettt.ReplaceMode(replaceMode); options.ReplaceMode {
+	case ettt.ReplaceStrict, ettt.ReplaceLenient:
+	default:
+		fmt.Fprintf(stdout, "invalid --replace-mode %s. strict or lenient\n", replaceMode)
+		return ettt.ExitCodeUsageError
+	}
+
+	switch ettt.BackoffStrategy(retryBackoff) {
+	case ettt.BackoffConstant, ettt.BackoffLinear, ettt.BackoffExponential:
+	default:
+		fmt.Fprintf(stdout, "invalid --retry-backoff %s. constant, linear or exponential\n", retryBackoff)
+		return ettt.ExitCodeUsageError
+	}
+	for _, policy := range []*ettt.RetryPolicy{&options.CommandRetry, &options.ScenarioRetry} {
+		policy.Delay = retryDelay
+		policy.Backoff = ettt.BackoffStrategy(retryBackoff)
+	}
+
+	if generateKey || "" != encrypt {
+		return secretCommand(options, generateKey, encrypt, stdout)
+	}
+
+	scenarios, err := Filter(ettt.RegisteredScenarios(), runExpr, skipExpr)
+	if err != nil {
+		fmt.Fprintln(stdout, err)
+		return ettt.ExitCodeUsageError
+	}
+
+	tagExpression, err := ettt.ParseTagExpression(options.TagExpression)
+	if err != nil {
+		fmt.Fprintln(stdout, err)
+		return ettt.ExitCodeUsageError
+	}
+
+	if list {
+		// タグ選択式を満たさないシナリオは実行対象外として出力する
+		for _, s := range scenarios {
+			var tags []string
+			if m, ok := s.Scenario.(ettt.MetadataScenario); ok {
+				tags = m.Metadata().Tags
+			}
+			if tagExpression.Match(tags) {
+				fmt.Fprintln(stdout, s.Name)
+			} else {
+				fmt.Fprintln(stdout, s.Name+"\t(not run)")
+			}
+		}
+		return ettt.ExitCodeNormal
+	}
+
+	// コンソールへの結果出力は標準出力ではなくstdoutに出力する
+	options.Reporters = ettt.DefaultReporters()
+	for i, r := range options.Reporters {
+		if _, ok := r.(ettt.ConsoleReporter); ok {
+			options.Reporters[i] = ettt.ConsoleReporter{Writer: stdout}
+		}
+	}
+	// --run / --skip で選択されないシナリオも実行対象外としてリストに残し、後続のシナリオをScenarioSkippedとする
+	options.RunExpression, options.SkipExpression = runExpr, skipExpr
+	engine, err := ettt.NewNamed(ettt.RegisteredScenarios(), extensions, options)
+	if err != nil {
+		slog.Error("failure create engine.", "error", err)
+		return ettt.ExitCodeError
+	}
+	// 割り込み時は実行中のPhaseをキャンセルし、TearDownとレポート出力を行って終了する
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := engine.RunContext(ctx); err != nil {
+		slog.Error("failure run engine.", "error", err)
+		return ettt.ExitCodeError
+	}
+	return ExitCode(engine.ResultStatus())
+}
+
+/*
+Filter
+シナリオ名に対して --run / --skip の正規表現でフィルタする.
+空の正規表現は指定なしとして扱う.
+*/
+func Filter(scenarios []ettt.NamedScenario, runExpr string, skipExpr string) ([]ettt.NamedScenario, error) {
+	nameFilter, err := ettt.ParseScenarioNameFilter(runExpr, skipExpr)
+	if err != nil {
+		return nil, err
+	}
+	var filtered []ettt.NamedScenario
+	for _, s := range scenarios {
+		if nameFilter.Match(s.Name) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered, nil
+}
+
+/*
+ExitCode
+集約したシナリオ実行結果ステータスから終了コードを判定する.
+*/
+func ExitCode(status ettt.ScenarioResultStatus) int {
+	switch status {
+	case ettt.ScenarioSuccess:
+		return ettt.ExitCodeNormal
+	case ettt.ScenarioAssertionError:
+		return ettt.ExitCodeAssertionError
+	default:
+		return ettt.ExitCodeError
+	}
+}
+
+/*
+keyValueFlag
+key=value 形式で繰り返し指定可能なフラグ.
+*/
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	var pairs []string
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f keyValueFlag) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok || "" == k {
+		return fmt.Errorf("invalid key=value. %s", value)
+	}
+	f[k] = v
+	return nil
+}
+
+/*
+secretCommand
+暗号化キーの生成、Profile変数値の暗号化を行う.
+*/
+func secretCommand(options ettt.Options, generateKey bool, encrypt string, stdout io.Writer) int {
+	if generateKey {
+		key, err := ettt.GenerateSecretKey()
+		if err != nil {
+			fmt.Fprintln(stdout, err)
+			return ettt.ExitCodeError
+		}
+		fmt.Fprintln(stdout, key)
+		return ettt.ExitCodeNormal
+	}
+	b, err := os.ReadFile(options.SecretKeyFile)
+	if err != nil {
+		fmt.Fprintln(stdout, err)
+		return ettt.ExitCodeUsageError
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		fmt.Fprintln(stdout, err)
+		return ettt.ExitCodeUsageError
+	}
+	encrypted, err := ettt.EncryptSecret(key, encrypt)
+	if err != nil {
+		fmt.Fprintln(stdout, err)
+		return ettt.ExitCodeError
+	}
+	fmt.Fprintln(stdout, encrypted)
+	return ettt.ExitCodeNormal
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"bytes"
+	"github.com/easy-to-test-tool/ettt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type noopScenario struct{}
+
+func (s noopScenario) Setup(gc ettt.GlobalContext, sc *ettt.ScenarioContext) error {
+	return nil
+}
+
+func (s noopScenario) Exercise(gc ettt.GlobalContext, sc *ettt.ScenarioContext) error {
+	return nil
+}
+
+func (s noopScenario) Verify(gc ettt.GlobalContext, sc *ettt.ScenarioContext) error {
+	return nil
+}
+
+func (s noopScenario) TearDown(gc ettt.GlobalContext, sc *ettt.ScenarioContext) error {
+	return nil
+}
+
+func init() {
+	ettt.RegisterScenario("cli/login", noopScenario{})
+	ettt.RegisterScenario("cli/order", noopScenario{})
+	ettt.RegisterScenario("cli/order_slow", noopScenario{})
+}
+
+/*
+TestRunList --listによるシナリオ一覧出力とフィルタ
+*/
+func TestRunList(t *testing.T) {
+	t.Run("フィルタなし", func(t *testing.T) {
+		var out bytes.Buffer
+		code := Run([]string{"--list"}, &out)
+		if code != ettt.ExitCodeNormal || out.String() != "cli/login\ncli/order\ncli/order_slow\n" {
+			t.Fatalf("failed test code=%d out=%q", code, out.String())
+		}
+	})
+	t.Run("--run と --skip", func(t *testing.T) {
+		var out bytes.Buffer
+		code := Run([]string{"--list", "--run", "order", "--skip", "_slow$"}, &out)
+		if code != ettt.ExitCodeNormal || out.String() != "cli/order\n" {
+			t.Fatalf("failed test code=%d out=%q", code, out.String())
+		}
+	})
+	t.Run("--tags を満たさないシナリオは実行対象外", func(t *testing.T) {
+		var out bytes.Buffer
+		code := Run([]string{"--list", "--run", "order", "--tags", "!slow"}, &out)
+		if code != ettt.ExitCodeNormal || out.String() != "cli/order\ncli/order_slow\n" {
+			t.Fatalf("failed test code=%d out=%q", code, out.String())
+		}
+		out.Reset()
+		code = Run([]string{"--list", "--run", "login", "--tags", "smoke"}, &out)
+		if code != ettt.ExitCodeNormal || out.String() != "cli/login\t(not run)\n" {
+			t.Fatalf("failed test code=%d out=%q", code, out.String())
+		}
+		if code := Run([]string{"--list", "--tags", "smoke &&"}, &out); code != ettt.ExitCodeUsageError {
+			t.Fatalf("failed test code=%d", code)
+		}
+	})
+	t.Run("不正な正規表現", func(t *testing.T) {
+		var out bytes.Buffer
+		if code := Run([]string{"--list", "--run", "("}, &out); code != ettt.ExitCodeUsageError {
+			t.Fatalf("failed test code=%d", code)
+		}
+	})
+}
+
+/*
+TestRunScenarios シナリオの実行と結果出力
+*/
+func TestRunScenarios(t *testing.T) {
+	t.Run("コンソールの結果はstdoutに出力し、--runで選択されないシナリオは実行対象外", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "test.yaml"), []byte("name: test\n"), 0o644); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		var out bytes.Buffer
+		code := Run([]string{"--run", "^cli/login$", "--profile", "test", "--profile-path", dir + string(os.PathSeparator), "--result", filepath.Join(dir, "results")}, &out)
+		if code != ettt.ExitCodeNormal || !strings.Contains(out.String(), "cli/login") || !strings.Contains(out.String(), "ScenarioSuccess 3 scenarios") || !strings.Contains(out.String(), "ScenarioNotRun: 2") {
+			t.Fatalf("failed test code=%d out=%q", code, out.String())
+		}
+	})
+}
+
+/*
+TestExitCode 集約ステータスから終了コードへの変換
+*/
+func TestExitCode(t *testing.T) {
+	if ExitCode(ettt.ScenarioSuccess) != ettt.ExitCodeNormal ||
+		ExitCode(ettt.ScenarioAssertionError) != ettt.ExitCodeAssertionError ||
+		ExitCode(ettt.ScenarioFailure) != ettt.ExitCodeError {
+		t.Fatal("failed test")
+	}
+}
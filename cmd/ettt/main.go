@@ -0,0 +1,15 @@
+/*
+ettt
+レジストリに登録されたシナリオを実行するコマンド.
+シナリオを実行するには、このmainをコピーしてシナリオパッケージをブランクインポートする.
+*/
+package main
+
+import (
+	"github.com/easy-to-test-tool/ettt/cli"
+	"os"
+)
+
+func main() {
+	os.Exit(cli.Run(os.Args[1:], os.Stdout))
+}
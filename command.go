@@ -1,6 +1,12 @@
 package ettt
 
-import "github.com/google/uuid"
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"reflect"
+	"time"
+)
 
 /*
 CommandResultStatus コマンド結果ステータス.
@@ -27,6 +33,47 @@ type CommandResult struct {
 	Message          string
 	CustomReportPath string
 	Error            error
+	// コマンドが保存したエビデンス
+	Evidences []Evidence
+	// コマンド表示名
+	Name string
+	// コマンドパラメータ
+	Parameters map[string]string
+	// 開始時間
+	Start time.Time
+	// 終了時間
+	End time.Time
+	// 実行時間（秒）
+	DurationSeconds float64
+	// コマンドの試行回数（1始まり）
+	Attempt int
+	// シナリオの試行回数（1始まり）
+	ScenarioAttempt int
+	// リトライにより後続の試行で置き換えられた結果か. シナリオの結果判定には利用しない.
+	Retried bool
+	// Eventuallyの試行毎の観測結果
+	Observations []Observation
+}
+
+/*
+merge
+コマンドが登録した結果を統合する.
+エビデンスは追記し、それ以外は登録された値で上書きする.
+*/
+func (r *CommandResult) merge(registered CommandResult) {
+	if "" != registered.Result {
+		r.Result = registered.Result
+	}
+	if "" != registered.Message {
+		r.Message = registered.Message
+	}
+	if "" != registered.CustomReportPath {
+		r.CustomReportPath = registered.CustomReportPath
+	}
+	if registered.Error != nil {
+		r.Error = registered.Error
+	}
+	r.Evidences = append(r.Evidences, registered.Evidences...)
 }
 
 /*
@@ -45,3 +92,137 @@ type Command interface {
 	*/
 	Execute(gc GlobalContext, sc *ScenarioContext)
 }
+
+/*
+ContextCommand
+実行中Phaseのコンテキストを引数で受け取るコマンドが任意で実装するインタフェース.
+実装している場合は、Executeの代わりに呼び出す.
+ctxはsc.Context()と同じで、Phaseのタイムアウト・実行全体のキャンセルで完了する.
+*/
+type ContextCommand interface {
+	Command
+	ExecuteContext(ctx context.Context, gc GlobalContext, sc *ScenarioContext)
+}
+
+/*
+NamedCommand
+コマンド表示名を指定する場合に任意で実装するインタフェース.
+実装していない場合は型名を表示名とする.
+*/
+type NamedCommand interface {
+	CommandName() string
+}
+
+/*
+ParameterizedCommand
+レポートに出力するパラメータを指定する場合に任意で実装するインタフェース.
+実装していない場合は構造体の公開フィールドをパラメータとする.
+*/
+type ParameterizedCommand interface {
+	CommandParameters() map[string]string
+}
+
+/*
+Run
+コマンドを実行し、実行結果を必ず登録する.
+開始・終了時間、panic、表示名、パラメータ、エビデンスを実行結果に記録する.
+コマンドが結果を登録しなかった場合はCommandSuccess、panicした場合はCommandFailureとなる.
+リトライポリシーに従ってリトライした場合は、全ての試行の結果を登録し、最後の試行の結果を返却する.
+*/
+func (sc *ScenarioContext) Run(gc GlobalContext, command Command) CommandResult {
+	policy := commandRetryPolicy(gc, command)
+	for attempt := 1; ; attempt++ {
+		result := sc.runCommand(gc, command, attempt)
+		if policy.shouldRetry(attempt, result.Result, result.Error) {
+			sc.Logger().Warn("retry command.", "command", result.Name, "result", result.Result, "attempt", attempt, "delay", policy.delay(attempt))
+			result.Retried = nil == policy.wait(sc.Context(), attempt)
+		}
+		sc.appendCommandResult(result)
+		sc.Logger().Info("end command.", "command", result.Name, "result", result.Result, "attempt", attempt)
+		if !result.Retried {
+			return result
+		}
+	}
+}
+
+/*
+runCommand
+コマンドを1回実行し、実行結果を作成する.
+*/
+func (sc *ScenarioContext) runCommand(gc GlobalContext, command Command, attempt int) CommandResult {
+	id := command.GetId()
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+	sc.running = &CommandResult{
+		Id:         id,
+		Result:     CommandSuccess,
+		Name:       commandName(command),
+		Parameters: commandParameters(command),
+		Start:      time.Now(),
+		Attempt:    attempt,
+	}
+	sc.Logger().Info("start command.", "command", sc.running.Name, "attempt", attempt)
+	err := callCommand(command, gc, sc)
+
+	result := *sc.running
+	sc.running = nil
+	result.End = time.Now()
+	result.DurationSeconds = result.End.Sub(result.Start).Seconds()
+	if err != nil {
+		result.Result = CommandFailure
+		result.Error = err
+	}
+	return result
+}
+
+/*
+callCommand
+コマンドを実行し、panicをPanicErrorに変換する.
+*/
+func callCommand(command Command, gc GlobalContext, sc *ScenarioContext) (err error) {
+	defer recoverPanic(&err)
+	if c, ok := command.(ContextCommand); ok {
+		c.ExecuteContext(sc.Context(), gc, sc)
+		return nil
+	}
+	command.Execute(gc, sc)
+	return nil
+}
+
+/*
+commandName
+コマンド表示名を解決.
+nilポインタのコマンドは型名を参照できないため、ポインタ型の表記を表示名とする.
+*/
+func commandName(command Command) string {
+	if n, ok := command.(NamedCommand); ok {
+		return n.CommandName()
+	}
+	v := reflect.Indirect(reflect.ValueOf(command))
+	if !v.IsValid() {
+		return fmt.Sprintf("%T", command)
+	}
+	return v.Type().Name()
+}
+
+/*
+commandParameters
+コマンドパラメータを解決.
+*/
+func commandParameters(command Command) map[string]string {
+	if p, ok := command.(ParameterizedCommand); ok {
+		return p.CommandParameters()
+	}
+	rv := reflect.Indirect(reflect.ValueOf(command))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	parameters := make(map[string]string)
+	for i := 0; i < rv.NumField(); i++ {
+		if f := rv.Type().Field(i); f.IsExported() {
+			parameters[f.Name] = fmt.Sprintf("%v", rv.Field(i).Interface())
+		}
+	}
+	return parameters
+}
@@ -0,0 +1,109 @@
+package ettt
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"os"
+	"testing"
+)
+
+/*
+evidenceCommand エビデンスを保存して結果を登録するテスト用コマンド.
+*/
+type evidenceCommand struct {
+	Url    string
+	result CommandResultStatus
+}
+
+func (c evidenceCommand) GetId() uuid.UUID {
+	return uuid.Nil
+}
+
+func (c evidenceCommand) Execute(gc GlobalContext, sc *ScenarioContext) {
+	sc.SaveEvidence("response.json", []byte(`{"ok":true}`))
+	sc.RegistrationCommandResult(CommandResult{Result: c.result, Message: "checked"})
+}
+
+/*
+panicCommand panicするテスト用コマンド.
+*/
+type panicCommand struct{}
+
+func (c panicCommand) GetId() uuid.UUID {
+	return uuid.Nil
+}
+
+func (c panicCommand) Execute(gc GlobalContext, sc *ScenarioContext) {
+	panic("unexpected")
+}
+
+func (c panicCommand) CommandName() string {
+	return "Panic!"
+}
+
+/*
+pointerCommand ポインタレシーバのテスト用コマンド.
+*/
+type pointerCommand struct {
+	Url string
+}
+
+func (c *pointerCommand) GetId() uuid.UUID {
+	return uuid.Nil
+}
+
+func (c *pointerCommand) Execute(gc GlobalContext, sc *ScenarioContext) {
+	sc.RegistrationCommandResult(CommandResult{Message: c.Url})
+}
+
+/*
+TestScenarioContextRun コマンド実行パイプライン
+*/
+func TestScenarioContextRun(t *testing.T) {
+	t.Run("登録結果・エビデンス・パラメータを1件の結果として記録", func(t *testing.T) {
+		sc := &ScenarioContext{phase: ScenarioPhaseExercise, evidencesDir: t.TempDir()}
+		r := sc.Run(GlobalContext{}, evidenceCommand{Url: "http://localhost", result: CommandAssertionError})
+		if len(sc.exercisePhaseResults) != 1 || sc.exercisePhaseResults[0].Message != "checked" {
+			t.Fatalf("failed test %#v", sc.exercisePhaseResults)
+		}
+		if r.Result != CommandAssertionError || r.Name != "evidenceCommand" || r.Parameters["Url"] != "http://localhost" {
+			t.Fatalf("failed test %#v", r)
+		}
+		if _, ok := r.Parameters["result"]; ok || r.End.Before(r.Start) {
+			t.Fatalf("failed test %#v", r)
+		}
+		if len(r.Evidences) != 1 {
+			t.Fatalf("failed test %#v", r.Evidences)
+		}
+		if bytes, err := os.ReadFile(r.Evidences[0].Path); err != nil || string(bytes) != `{"ok":true}` {
+			t.Fatalf("failed test %#v", err)
+		}
+		if JudgeScenarioResult(*sc) != ScenarioAssertionError {
+			t.Fatal("failed test")
+		}
+	})
+	t.Run("panicはCommandFailureとして記録", func(t *testing.T) {
+		sc := &ScenarioContext{phase: ScenarioPhaseSetup}
+		r := sc.Run(GlobalContext{}, panicCommand{})
+		var panicError *PanicError
+		if r.Result != CommandFailure || r.Name != "Panic!" || !errors.As(r.Error, &panicError) {
+			t.Fatalf("failed test %#v", r)
+		}
+		sc.verifyPhaseResults = append(sc.verifyPhaseResults, CommandResult{Result: CommandAssertionError})
+		if JudgeScenarioResult(*sc) != ScenarioFailure {
+			t.Fatal("failed test")
+		}
+	})
+	t.Run("nilポインタのコマンドはCommandFailureとして記録", func(t *testing.T) {
+		sc := &ScenarioContext{phase: ScenarioPhaseExercise}
+		var command *pointerCommand
+		r := sc.Run(GlobalContext{}, command)
+		var panicError *PanicError
+		if r.Result != CommandFailure || r.Name != "*ettt.pointerCommand" || !errors.As(r.Error, &panicError) {
+			t.Fatalf("failed test %#v", r)
+		}
+		if 0 != len(r.Parameters) {
+			t.Fatalf("failed test %#v", r.Parameters)
+		}
+	})
+}
@@ -0,0 +1,192 @@
+/*
+Package file
+ファイルを扱うコマンドを提供するモジュール.
+
+	render := &file.Render{Template: "testdata/create-user.json"}
+	sc.Run(gc, render)
+	sc.Run(gc, &http.Request{Method: "POST", Url: "${profile.baseUrl}/users", Body: string(render.Content())})
+*/
+package file
+
+import (
+	"fmt"
+	"github.com/easy-to-test-tool/ettt"
+	"github.com/google/uuid"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Format テンプレートファイルの形式.
+*/
+type Format string
+
+const (
+	FormatText = Format("text")
+	FormatJSON = Format("json")
+	FormatYAML = Format("yaml")
+)
+
+/*
+Render
+テンプレートファイルの変数を置換してファイルに出力するコマンド.
+JSON・YAMLの場合は文字列の値のみを置換するため、置換後の値によって構造が壊れることはない.
+置換結果は一時ファイル（Path）に出力し、シナリオのクリーンアップで削除する.
+エビデンスには秘匿値をマスクした写しを保存する.
+*/
+type Render struct {
+	Id uuid.UUID
+	// テンプレートファイルのパス. パスも ${スコープ.変数名} を置換する.
+	Template string
+	// 出力するエビデンス名. 省略時はテンプレートのファイル名.
+	Name string
+	// テンプレートの形式. 省略時は拡張子（.json / .yaml, .yml）から判定し、それ以外はテキストとする.
+	Format Format
+	// JSON・YAMLの場合に、値全体が1つの変数（"${store.count}" など）であれば変数の値の型を保つ.
+	KeepType bool
+	// 出力したファイル（秘匿値をマスクしない置換結果）のパスを保存するStore変数名.
+	StoreAs string
+
+	content  []byte
+	path     string
+	evidence ettt.Evidence
+}
+
+func (c *Render) GetId() uuid.UUID {
+	return c.Id
+}
+
+func (c *Render) CommandName() string {
+	return "Render " + c.name()
+}
+
+func (c *Render) CommandParameters() map[string]string {
+	return map[string]string{
+		"template": c.Template,
+		"format":   string(c.format()),
+	}
+}
+
+/*
+Content
+直近の実行で置換したテンプレートの内容.
+未実行またはエラーの場合はnil.
+*/
+func (c *Render) Content() []byte {
+	return c.content
+}
+
+/*
+Path
+直近の実行で出力したファイル（秘匿値をマスクしない置換結果）のパス.
+ファイルはシナリオのクリーンアップで削除される.
+未実行またはエラーの場合は空文字.
+*/
+func (c *Render) Path() string {
+	return c.path
+}
+
+/*
+EvidencePath
+直近の実行で保存したエビデンス（秘匿値をマスクした写し）のパス.
+未実行またはエラーの場合は空文字.
+*/
+func (c *Render) EvidencePath() string {
+	return c.evidence.Path
+}
+
+func (c *Render) Execute(gc ettt.GlobalContext, sc *ettt.ScenarioContext) {
+	c.content = nil
+	c.path = ""
+	c.evidence = ettt.Evidence{}
+	content, err := c.render(gc, sc)
+	if err != nil {
+		sc.RegistrationCommandFailure("failure render template.", err)
+		return
+	}
+	path, err := c.write(sc, content)
+	if err != nil {
+		sc.RegistrationCommandFailure("failure write rendered template.", err)
+		return
+	}
+	evidence, err := sc.SaveEvidence(c.name(), content)
+	if err != nil {
+		sc.RegistrationCommandFailure("failure save rendered template.", err)
+		return
+	}
+	if "" != c.StoreAs {
+		sc.Store().PutString(c.StoreAs, path)
+	}
+	c.content, c.path, c.evidence = content, path, evidence
+	sc.RegistrationCommandResult(ettt.CommandResult{
+		Result:  ettt.CommandSuccess,
+		Message: fmt.Sprintf("rendered %s -> %s", c.Template, evidence.Path),
+	})
+}
+
+/*
+write
+置換結果を一時ファイルに出力し、シナリオのクリーンアップで削除するよう登録する.
+秘匿値を含むため、エビデンス格納ディレクトリには出力しない.
+*/
+func (c *Render) write(sc *ettt.ScenarioContext, content []byte) (string, error) {
+	f, err := os.CreateTemp("", "ettt-render-*-"+filepath.Base(c.name()))
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	sc.Cleanup("remove rendered "+c.name(), func() error {
+		return os.Remove(path)
+	})
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+/*
+render
+テンプレートファイルを読み込み、形式に従って変数を置換する.
+*/
+func (c *Render) render(gc ettt.GlobalContext, sc *ettt.ScenarioContext) ([]byte, error) {
+	path, err := ettt.Replace(gc, *sc, c.Template)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch c.format() {
+	case FormatJSON:
+		return ettt.ReplaceJSON(gc, *sc, data, c.KeepType)
+	case FormatYAML:
+		return ettt.ReplaceYAML(gc, *sc, data, c.KeepType)
+	case FormatText:
+		s, err := ettt.Replace(gc, *sc, string(data))
+		return []byte(s), err
+	}
+	return nil, fmt.Errorf("unknown template format %s", c.Format)
+}
+
+func (c *Render) name() string {
+	if "" != c.Name {
+		return c.Name
+	}
+	return filepath.Base(c.Template)
+}
+
+func (c *Render) format() Format {
+	if "" != c.Format {
+		return c.Format
+	}
+	switch strings.ToLower(filepath.Ext(c.Template)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	return FormatText
+}
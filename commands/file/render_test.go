@@ -0,0 +1,121 @@
+package file
+
+import (
+	"github.com/easy-to-test-tool/ettt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/*
+fileScenario ファイルコマンドを実行するテスト用シナリオ.
+*/
+type fileScenario struct {
+	commands []ettt.Command
+	results  *[]ettt.CommandResult
+	verify   func(sc *ettt.ScenarioContext)
+}
+
+func (s fileScenario) Setup(gc ettt.GlobalContext, sc *ettt.ScenarioContext) error {
+	sc.Store().PutNumber("count", 3)
+	return nil
+}
+
+func (s fileScenario) Exercise(gc ettt.GlobalContext, sc *ettt.ScenarioContext) error {
+	for _, c := range s.commands {
+		*s.results = append(*s.results, sc.Run(gc, c))
+	}
+	return nil
+}
+
+func (s fileScenario) Verify(gc ettt.GlobalContext, sc *ettt.ScenarioContext) error {
+	if s.verify != nil {
+		s.verify(sc)
+	}
+	return nil
+}
+
+func (s fileScenario) TearDown(gc ettt.GlobalContext, sc *ettt.ScenarioContext) error {
+	return nil
+}
+
+/*
+TestRender テンプレートファイルの出力
+*/
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"test.yaml":      "name: test\nvariables:\n  - key: name\n    value: alice\n  - key: token\n    value: render-secret-token\n    secret: true\n  - key: dir\n    value: " + dir + "\n",
+		"body.json":      `{"name":"${profile.name}","count":"${store.count}"}`,
+		"body.yaml":      "name: ${profile.name}\ncount: \"${store.count}\"\n",
+		"message.txt":    "hello ${profile.name} $${raw}",
+		"unresolved.txt": "${profile.unknown}",
+		"secret.txt":     "token=${profile.token}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+	}
+	commands := []*Render{
+		{Template: "${profile.dir}/body.json", KeepType: true, StoreAs: "bodyPath"},
+		{Template: filepath.Join(dir, "body.yaml"), Name: "request.yaml"},
+		{Template: filepath.Join(dir, "message.txt")},
+		{Template: filepath.Join(dir, "unresolved.txt")},
+		{Template: filepath.Join(dir, "secret.txt"), StoreAs: "secretPath"},
+	}
+	var results []ettt.CommandResult
+	var stored string
+	scenario := fileScenario{results: &results, verify: func(sc *ettt.ScenarioContext) {
+		path, _ := sc.Store().GetString("secretPath")
+		b, _ := os.ReadFile(path)
+		stored = string(b)
+	}}
+	for _, c := range commands {
+		scenario.commands = append(scenario.commands, c)
+	}
+	engine, err := ettt.New([]ettt.Scenario{scenario}, nil, ettt.Options{
+		Profile:     "test",
+		ProfilePath: dir,
+		ResultPath:  filepath.Join(dir, "results"),
+	})
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	if err := engine.Run(); err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+
+	expected := []string{
+		`{"name":"alice","count":3}`,
+		"name: alice\ncount: \"3\"\n",
+		"hello alice ${raw}",
+	}
+	for i, e := range expected {
+		if ettt.CommandSuccess != results[i].Result || e != string(commands[i].Content()) {
+			t.Fatalf("failed test index=%d %#v %s", i, results[i], commands[i].Content())
+		}
+		b, err := os.ReadFile(commands[i].EvidencePath())
+		if err != nil || e != string(b) || 1 != len(results[i].Evidences) {
+			t.Fatalf("failed test index=%d %#v %s", i, err, b)
+		}
+	}
+	if "request.yaml" != results[1].Evidences[0].Name {
+		t.Fatalf("failed test %#v", results[1].Evidences)
+	}
+	if ettt.CommandFailure != results[3].Result || nil != commands[3].Content() {
+		t.Fatalf("failed test %#v", results[3])
+	}
+	// StoreAsのファイルは秘匿値をマスクせず、エビデンスはマスクする
+	if "token=render-secret-token" != stored {
+		t.Fatalf("failed test %s", stored)
+	}
+	b, err := os.ReadFile(commands[4].EvidencePath())
+	if err != nil || "token="+ettt.SecretMask != string(b) {
+		t.Fatalf("failed test %#v %s", err, b)
+	}
+	// 出力したファイルはクリーンアップで削除する
+	if _, err := os.Stat(commands[4].Path()); !os.IsNotExist(err) {
+		t.Fatalf("failed test %#v", err)
+	}
+}
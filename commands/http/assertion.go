@@ -0,0 +1,187 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/easy-to-test-tool/ettt"
+	"github.com/google/uuid"
+	"reflect"
+)
+
+/*
+errNoResponse アサーション対象のレスポンスが存在しない.
+*/
+var errNoResponse = errors.New("request has no response. execute request before assertion")
+
+/*
+AssertStatus
+ステータスコードのアサーション.
+*/
+type AssertStatus struct {
+	Id       uuid.UUID
+	Request  *Request
+	Expected int
+}
+
+func (c AssertStatus) GetId() uuid.UUID {
+	return c.Id
+}
+
+func (c AssertStatus) CommandParameters() map[string]string {
+	return map[string]string{"expected": fmt.Sprint(c.Expected)}
+}
+
+func (c AssertStatus) Execute(gc ettt.GlobalContext, sc *ettt.ScenarioContext) {
+	resp := c.Request.Response()
+	if resp == nil {
+		sc.RegistrationCommandFailure("no response.", errNoResponse)
+		return
+	}
+	assertion(sc, resp.StatusCode == c.Expected,
+		fmt.Sprintf("status code expected %d, actual %d", c.Expected, resp.StatusCode))
+}
+
+/*
+AssertHeader
+レスポンスヘッダのアサーション.
+期待値は ${スコープ.変数名} を置換してから比較する.
+*/
+type AssertHeader struct {
+	Id       uuid.UUID
+	Request  *Request
+	Name     string
+	Expected string
+}
+
+func (c AssertHeader) GetId() uuid.UUID {
+	return c.Id
+}
+
+func (c AssertHeader) CommandParameters() map[string]string {
+	return map[string]string{"name": c.Name, "expected": c.Expected}
+}
+
+func (c AssertHeader) Execute(gc ettt.GlobalContext, sc *ettt.ScenarioContext) {
+	resp := c.Request.Response()
+	if resp == nil {
+		sc.RegistrationCommandFailure("no response.", errNoResponse)
+		return
+	}
+	expected, err := ettt.Replace(gc, *sc, c.Expected)
+	if err != nil {
+		sc.RegistrationCommandFailure("failure replace expected value.", err)
+		return
+	}
+	actual := resp.Header.Get(c.Name)
+	assertion(sc, actual == expected,
+		fmt.Sprintf("header %s expected %q, actual %q", c.Name, expected, actual))
+}
+
+/*
+AssertJSONPath
+レスポンスボディのJSONPathで指定した値のアサーション.
+期待値はJSONとして同値であるかを比較する（数値型の違いは無視される）.
+期待値が文字列の場合は ${スコープ.変数名} を置換してから比較する.
+*/
+type AssertJSONPath struct {
+	Id       uuid.UUID
+	Request  *Request
+	Path     string
+	Expected any
+}
+
+func (c AssertJSONPath) GetId() uuid.UUID {
+	return c.Id
+}
+
+func (c AssertJSONPath) CommandParameters() map[string]string {
+	return map[string]string{"path": c.Path, "expected": fmt.Sprint(c.Expected)}
+}
+
+func (c AssertJSONPath) Execute(gc ettt.GlobalContext, sc *ettt.ScenarioContext) {
+	resp := c.Request.Response()
+	if resp == nil {
+		sc.RegistrationCommandFailure("no response.", errNoResponse)
+		return
+	}
+	document, err := decodeJSON(resp.Body)
+	if err != nil {
+		sc.RegistrationCommandFailure("response body is not json.", err)
+		return
+	}
+	actual, err := EvaluateJSONPath(document, c.Path)
+	if err != nil {
+		assertion(sc, false, err.Error())
+		return
+	}
+	expected := c.Expected
+	if s, ok := expected.(string); ok {
+		if expected, err = ettt.Replace(gc, *sc, s); err != nil {
+			sc.RegistrationCommandFailure("failure replace expected value.", err)
+			return
+		}
+	}
+	if expected, err = normalizeJSON(expected); err != nil {
+		sc.RegistrationCommandFailure("expected value is not json serializable.", err)
+		return
+	}
+	assertion(sc, reflect.DeepEqual(actual, expected),
+		fmt.Sprintf("json path %s expected %v, actual %v", c.Path, expected, actual))
+}
+
+/*
+AssertJSONSchema
+レスポンスボディのJSON Schemaによるアサーション.
+対応するキーワードは ValidateJSONSchema を参照.
+*/
+type AssertJSONSchema struct {
+	Id      uuid.UUID
+	Request *Request
+	// JSON Schema文字列
+	Schema string
+}
+
+func (c AssertJSONSchema) GetId() uuid.UUID {
+	return c.Id
+}
+
+func (c AssertJSONSchema) CommandParameters() map[string]string {
+	return map[string]string{"schema": c.Schema}
+}
+
+func (c AssertJSONSchema) Execute(gc ettt.GlobalContext, sc *ettt.ScenarioContext) {
+	resp := c.Request.Response()
+	if resp == nil {
+		sc.RegistrationCommandFailure("no response.", errNoResponse)
+		return
+	}
+	schema, err := decodeJSON([]byte(c.Schema))
+	if err != nil {
+		sc.RegistrationCommandFailure("schema is not json.", err)
+		return
+	}
+	document, err := decodeJSON(resp.Body)
+	if err != nil {
+		sc.RegistrationCommandFailure("response body is not json.", err)
+		return
+	}
+	violations := ValidateJSONSchema(schema, document)
+	if 0 == len(violations) {
+		assertion(sc, true, "json schema valid")
+		return
+	}
+	assertion(sc, false, fmt.Sprintf("json schema invalid. %v", violations))
+}
+
+/*
+normalizeJSON
+Goの値をJSONとしてデコードした場合と同じ型に変換する.
+*/
+func normalizeJSON(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(b)
+}
@@ -0,0 +1,153 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+EvaluateJSONPath
+JSONPathで指定した値を取得する.
+対応する構文は以下のサブセット.
+
+	$            ルート
+	.name        オブジェクトのキー
+	['name']     オブジェクトのキー（記号を含む場合）
+	[0] / [-1]   配列のインデックス（負数は末尾から）
+	[*] / .*     全要素（結果は配列となる）
+*/
+func EvaluateJSONPath(document any, path string) (any, error) {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []any{document}
+	wildcard := false
+	for _, segment := range segments {
+		var next []any
+		for _, node := range nodes {
+			values, err := segment.apply(node)
+			if err != nil {
+				return nil, fmt.Errorf("json path %s: %w", path, err)
+			}
+			next = append(next, values...)
+		}
+		if segment.wildcard {
+			wildcard = true
+		}
+		nodes = next
+	}
+	if wildcard {
+		if nodes == nil {
+			return []any{}, nil
+		}
+		return nodes, nil
+	}
+	return nodes[0], nil
+}
+
+/*
+jsonPathSegment
+JSONPathの要素.
+*/
+type jsonPathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func (s jsonPathSegment) apply(node any) ([]any, error) {
+	switch {
+	case s.wildcard:
+		switch n := node.(type) {
+		case []any:
+			return n, nil
+		case map[string]any:
+			values := make([]any, 0, len(n))
+			for _, v := range n {
+				values = append(values, v)
+			}
+			return values, nil
+		}
+		return nil, fmt.Errorf("wildcard target is not array or object")
+	case s.isIndex:
+		array, ok := node.([]any)
+		if !ok {
+			return nil, fmt.Errorf("index [%d] target is not array", s.index)
+		}
+		i := s.index
+		if i < 0 {
+			i += len(array)
+		}
+		if i < 0 || i >= len(array) {
+			return nil, fmt.Errorf("index [%d] out of range. length : %d", s.index, len(array))
+		}
+		return []any{array[i]}, nil
+	default:
+		object, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("key %s target is not object", s.key)
+		}
+		v, ok := object[s.key]
+		if !ok {
+			return nil, fmt.Errorf("key %s not found", s.key)
+		}
+		return []any{v}, nil
+	}
+}
+
+/*
+parseJSONPath
+JSONPath文字列を要素に分解.
+*/
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("json path must start with $. path : %s", path)
+	}
+	var segments []jsonPathSegment
+	rest := path[1:]
+	for "" != rest {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			if "" == key {
+				return nil, fmt.Errorf("empty key in json path. path : %s", path)
+			}
+			if "*" == key {
+				segments = append(segments, jsonPathSegment{wildcard: true})
+			} else {
+				segments = append(segments, jsonPathSegment{key: key})
+			}
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed bracket in json path. path : %s", path)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case "*" == inner:
+				segments = append(segments, jsonPathSegment{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				segments = append(segments, jsonPathSegment{key: inner[1 : len(inner)-1]})
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index [%s] in json path. path : %s", inner, path)
+				}
+				segments = append(segments, jsonPathSegment{index: i, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected character %q in json path. path : %s", rest[0], path)
+		}
+	}
+	return segments, nil
+}
@@ -0,0 +1,349 @@
+/*
+Package http
+REST API実行コマンドとアサーションコマンドを提供するモジュール.
+
+	req := &http.Request{Method: "GET", Url: "${profile.baseUrl}/users/1"}
+	sc.Run(gc, req)
+	sc.Run(gc, http.AssertStatus{Request: req, Expected: 200})
+	sc.Run(gc, http.AssertJSONPath{Request: req, Path: "$.name", Expected: "alice"})
+*/
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/easy-to-test-tool/ettt"
+	"github.com/google/uuid"
+	"io"
+	nethttp "net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Request
+HTTPリクエスト実行コマンド.
+文字列項目は ${スコープ.変数名} を ettt.Replace で置換してから送信する.
+リクエスト・レスポンスはエビデンスとして保存する.
+*/
+type Request struct {
+	Id     uuid.UUID
+	Method string
+	Url    string
+	// リクエストヘッダ
+	Headers map[string]string
+	// クエリパラメータ
+	Query map[string]string
+	// JSONボディ. JSONに変換後、文字列の値を置換する.
+	JSONBody any
+	// フォームボディ（application/x-www-form-urlencoded）
+	FormBody map[string]string
+	// 生のボディ
+	Body string
+	// タイムアウト. 0の場合はシナリオのPhaseコンテキストのみで制御する.
+	Timeout time.Duration
+	// TLS設定
+	TLS TLSOptions
+	// レスポンスを保存するStore変数名.
+	// 指定した場合は status, headers, body を持つJSON型の変数として保存する.
+	// bodyはJSONとして解析できればJSON、できなければ文字列となる.
+	StoreAs string
+
+	response *Response
+}
+
+/*
+TLSOptions
+TLS接続オプション.
+*/
+type TLSOptions struct {
+	// サーバ証明書の検証を行わない
+	InsecureSkipVerify bool
+	// 信頼するCA証明書（PEM）のパス
+	CACertFile string
+	// クライアント証明書（PEM）のパス
+	ClientCertFile string
+	// クライアント秘密鍵（PEM）のパス
+	ClientKeyFile string
+}
+
+/*
+Response
+HTTPレスポンス.
+*/
+type Response struct {
+	StatusCode int
+	Header     nethttp.Header
+	Body       []byte
+	Duration   time.Duration
+}
+
+func (c *Request) GetId() uuid.UUID {
+	return c.Id
+}
+
+func (c *Request) CommandName() string {
+	return "HTTP " + strings.ToUpper(c.method())
+}
+
+func (c *Request) CommandParameters() map[string]string {
+	return map[string]string{
+		"method": c.method(),
+		"url":    c.Url,
+	}
+}
+
+/*
+Response
+直近の実行で受信したレスポンス.
+未実行またはエラーの場合はnil.
+*/
+func (c *Request) Response() *Response {
+	return c.response
+}
+
+func (c *Request) Execute(gc ettt.GlobalContext, sc *ettt.ScenarioContext) {
+	c.response = nil
+	req, err := c.build(gc, sc)
+	if err != nil {
+		sc.RegistrationCommandFailure("failure build request.", err)
+		return
+	}
+	client, err := c.client()
+	if err != nil {
+		sc.RegistrationCommandFailure("failure create http client.", err)
+		return
+	}
+	if 0 < c.Timeout {
+		ctx, cancel := context.WithTimeout(req.Context(), c.Timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+		sc.SaveEvidence("request.txt", dump)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		sc.RegistrationCommandFailure("failure send request.", err)
+		return
+	}
+	defer resp.Body.Close()
+	if dump, err := httputil.DumpResponse(resp, true); err == nil {
+		sc.SaveEvidence("response.txt", dump)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		sc.RegistrationCommandFailure("failure read response body.", err)
+		return
+	}
+	c.response = &Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+		Duration:   time.Since(start),
+	}
+	if "" != c.StoreAs {
+		if err := c.store(sc); err != nil {
+			sc.RegistrationCommandFailure("failure store response.", err)
+			return
+		}
+	}
+	sc.RegistrationCommandResult(ettt.CommandResult{
+		Result:  ettt.CommandSuccess,
+		Message: fmt.Sprintf("%s %s -> %d", req.Method, req.URL.Redacted(), resp.StatusCode),
+	})
+}
+
+/*
+store
+レスポンスをStore変数として保存.
+*/
+func (c *Request) store(sc *ettt.ScenarioContext) error {
+	headers := make(map[string]string, len(c.response.Header))
+	for k := range c.response.Header {
+		headers[k] = c.response.Header.Get(k)
+	}
+	var body any = string(c.response.Body)
+	if v, err := decodeJSON(c.response.Body); err == nil {
+		body = v
+	}
+	return sc.Store().Put(c.StoreAs, map[string]any{
+		"status":  c.response.StatusCode,
+		"headers": headers,
+		"body":    body,
+	})
+}
+
+func (c *Request) method() string {
+	if "" == c.Method {
+		return nethttp.MethodGet
+	}
+	return c.Method
+}
+
+/*
+build
+変数を置換してリクエストを作成.
+JSONボディは文字列の値のみを置換し、置換後の値はJSONとしてエスケープする.
+*/
+func (c *Request) build(gc ettt.GlobalContext, sc *ettt.ScenarioContext) (*nethttp.Request, error) {
+	replace := func(s string) (string, error) {
+		return ettt.Replace(gc, *sc, s)
+	}
+
+	rawUrl, err := replace(c.Url)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	if 0 != len(c.Query) {
+		q := u.Query()
+		for k, v := range c.Query {
+			if v, err = replace(v); err != nil {
+				return nil, err
+			}
+			q.Set(k, v)
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	var body io.Reader
+	var contentType string
+	switch {
+	case c.JSONBody != nil:
+		b, err := json.Marshal(c.JSONBody)
+		if err != nil {
+			return nil, err
+		}
+		if b, err = ettt.ReplaceJSON(gc, *sc, b, false); err != nil {
+			return nil, err
+		}
+		body, contentType = strings.NewReader(string(b)), "application/json"
+	case c.FormBody != nil:
+		form := url.Values{}
+		for k, v := range c.FormBody {
+			if v, err = replace(v); err != nil {
+				return nil, err
+			}
+			form.Set(k, v)
+		}
+		body, contentType = strings.NewReader(form.Encode()), "application/x-www-form-urlencoded"
+	case "" != c.Body:
+		s, err := replace(c.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(s)
+	}
+
+	req, err := nethttp.NewRequestWithContext(sc.Context(), strings.ToUpper(c.method()), u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if "" != contentType {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range c.Headers {
+		if v, err = replace(v); err != nil {
+			return nil, err
+		}
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+/*
+TLS設定毎のトランスポート.
+接続を再利用し、リクエスト毎にコネクションが残らないよう、同じTLS設定のリクエストで共有する.
+*/
+var transports = struct {
+	mu    sync.Mutex
+	cache map[TLSOptions]*nethttp.Transport
+}{cache: make(map[TLSOptions]*nethttp.Transport)}
+
+/*
+client
+TLS設定を反映したクライアントを作成.
+タイムアウトはリクエストのコンテキストで制御する.
+*/
+func (c *Request) client() (*nethttp.Client, error) {
+	transport, err := tlsTransport(c.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return &nethttp.Client{Transport: transport}, nil
+}
+
+/*
+tlsTransport
+TLS設定に対応するトランスポートを取得. 初回のみ証明書を読み込んで作成する.
+*/
+func tlsTransport(options TLSOptions) (*nethttp.Transport, error) {
+	transports.mu.Lock()
+	defer transports.mu.Unlock()
+	if transport, ok := transports.cache[options]; ok {
+		return transport, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: options.InsecureSkipVerify}
+	if "" != options.CACertFile {
+		pem, err := os.ReadFile(options.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", options.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if "" != options.ClientCertFile {
+		cert, err := tls.LoadX509KeyPair(options.ClientCertFile, options.ClientKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport := nethttp.DefaultTransport.(*nethttp.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transports.cache[options] = transport
+	return transport, nil
+}
+
+/*
+assertion
+アサーション結果を登録.
+*/
+func assertion(sc *ettt.ScenarioContext, ok bool, message string) {
+	result := ettt.CommandSuccess
+	if !ok {
+		result = ettt.CommandAssertionError
+	}
+	sc.RegistrationCommandResult(ettt.CommandResult{
+		Result:  result,
+		Message: message,
+	})
+}
+
+/*
+decodeJSON
+レスポンスボディをJSONとして解析.
+*/
+func decodeJSON(body []byte) (any, error) {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,226 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/easy-to-test-tool/ettt"
+	"github.com/google/uuid"
+	nethttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/*
+httpScenario HTTPコマンドを実行するテスト用シナリオ.
+*/
+type httpScenario struct {
+	commands func() []ettt.Command
+	results  *[]ettt.CommandResult
+}
+
+func (s httpScenario) Setup(gc ettt.GlobalContext, sc *ettt.ScenarioContext) error {
+	return nil
+}
+
+func (s httpScenario) Exercise(gc ettt.GlobalContext, sc *ettt.ScenarioContext) error {
+	for _, c := range s.commands() {
+		*s.results = append(*s.results, sc.Run(gc, c))
+	}
+	return nil
+}
+
+func (s httpScenario) Verify(gc ettt.GlobalContext, sc *ettt.ScenarioContext) error {
+	return nil
+}
+
+func (s httpScenario) TearDown(gc ettt.GlobalContext, sc *ettt.ScenarioContext) error {
+	return nil
+}
+
+/*
+runCommands テスト用のProfileでシナリオを実行し、コマンド結果を返却する.
+*/
+func runCommands(t *testing.T, baseUrl string, commands func() []ettt.Command) []ettt.CommandResult {
+	t.Helper()
+	dir := t.TempDir()
+	profile := "name: test\nvariables:\n  - key: baseUrl\n    value: " + baseUrl + "\n  - key: token\n    value: secret-token\n  - key: quoted\n    value: 'say \"hi\" \\ bye'\n"
+	if err := os.WriteFile(filepath.Join(dir, "test.yaml"), []byte(profile), 0o644); err != nil {
+		t.Fatalf("failed write profile %#v", err)
+	}
+	var results []ettt.CommandResult
+	engine, err := ettt.New([]ettt.Scenario{httpScenario{commands: commands, results: &results}}, nil, ettt.Options{
+		Profile:     "test",
+		ProfilePath: dir + string(os.PathSeparator),
+		ResultPath:  filepath.Join(dir, "results"),
+	})
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	if err := engine.Run(); err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	return results
+}
+
+/*
+storeCheck StoreAsで保存したレスポンスを確認するテスト用コマンド.
+*/
+type storeCheck struct{}
+
+func (c storeCheck) GetId() uuid.UUID {
+	return uuid.Nil
+}
+
+func (c storeCheck) Execute(gc ettt.GlobalContext, sc *ettt.ScenarioContext) {
+	var created struct {
+		Status int
+		Body   struct{ Name string }
+	}
+	result := ettt.CommandAssertionError
+	if err := sc.Store().GetJSON("created", &created); err == nil && created.Status == 200 && created.Body.Name == "alice" {
+		result = ettt.CommandSuccess
+	}
+	sc.RegistrationCommandResult(ettt.CommandResult{Result: result})
+}
+
+func newServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.WriteHeader(nethttp.StatusUnauthorized)
+			return
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Query", r.URL.Query().Get("q"))
+		json.NewEncoder(w).Encode(map[string]any{
+			"name":  body["name"],
+			"items": []any{map[string]any{"id": 1}, map[string]any{"id": 2}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+/*
+TestRequest HTTPリクエストとアサーション
+*/
+func TestRequest(t *testing.T) {
+	server := newServer(t)
+	t.Run("変数置換・エビデンス保存・アサーション成功", func(t *testing.T) {
+		results := runCommands(t, server.URL, func() []ettt.Command {
+			req := &Request{
+				StoreAs:  "created",
+				Method:   "POST",
+				Url:      "${profile.baseUrl}/users",
+				Headers:  map[string]string{"Authorization": "Bearer ${profile.token}"},
+				Query:    map[string]string{"q": "${profile.token}"},
+				JSONBody: map[string]any{"name": "alice"},
+			}
+			return []ettt.Command{
+				req,
+				AssertStatus{Request: req, Expected: 200},
+				AssertHeader{Request: req, Name: "X-Query", Expected: "${profile.token}"},
+				AssertJSONPath{Request: req, Path: "$.name", Expected: "alice"},
+				AssertJSONPath{Request: req, Path: "$.items[-1].id", Expected: 2},
+				AssertJSONPath{Request: req, Path: "$.items[*].id", Expected: []int{1, 2}},
+				storeCheck{},
+				AssertJSONSchema{Request: req, Schema: `{
+					"type": "object",
+					"required": ["name", "items"],
+					"properties": {
+						"name": {"type": "string", "minLength": 1},
+						"items": {"type": "array", "items": {"type": "object", "properties": {"id": {"type": "integer"}}}}
+					}
+				}`},
+			}
+		})
+		for i, r := range results {
+			if r.Result != ettt.CommandSuccess {
+				t.Fatalf("failed test index=%d %#v", i, r)
+			}
+		}
+		if len(results[0].Evidences) != 2 {
+			t.Fatalf("failed test %#v", results[0].Evidences)
+		}
+	})
+	t.Run("JSONボディの変数置換は値をエスケープする", func(t *testing.T) {
+		results := runCommands(t, server.URL, func() []ettt.Command {
+			req := &Request{
+				Method:   "POST",
+				Url:      "${profile.baseUrl}/users",
+				Headers:  map[string]string{"Authorization": "Bearer ${profile.token}"},
+				JSONBody: map[string]any{"name": "${profile.quoted}", "role": "user"},
+			}
+			return []ettt.Command{
+				req,
+				AssertStatus{Request: req, Expected: 200},
+				AssertJSONPath{Request: req, Path: "$.name", Expected: `say "hi" \ bye`},
+			}
+		})
+		for i, r := range results {
+			if r.Result != ettt.CommandSuccess {
+				t.Fatalf("failed test index=%d %#v", i, r)
+			}
+		}
+	})
+	t.Run("同じTLS設定のリクエストはトランスポートを共有する", func(t *testing.T) {
+		a, err := tlsTransport(TLSOptions{})
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		b, _ := tlsTransport(TLSOptions{})
+		insecure, _ := tlsTransport(TLSOptions{InsecureSkipVerify: true})
+		if a != b || a == insecure {
+			t.Fatalf("failed test %p %p %p", a, b, insecure)
+		}
+	})
+	t.Run("タイムアウトはリクエストのコンテキストで制御する", func(t *testing.T) {
+		slow := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}))
+		t.Cleanup(slow.Close)
+		results := runCommands(t, slow.URL, func() []ettt.Command {
+			return []ettt.Command{&Request{Url: "${profile.baseUrl}/slow", Timeout: 20 * time.Millisecond}}
+		})
+		if ettt.CommandFailure != results[0].Result || !errors.Is(results[0].Error, context.DeadlineExceeded) {
+			t.Fatalf("failed test %#v", results[0])
+		}
+	})
+	t.Run("アサーションエラー", func(t *testing.T) {
+		results := runCommands(t, server.URL, func() []ettt.Command {
+			req := &Request{Url: "${profile.baseUrl}/users"}
+			return []ettt.Command{
+				req,
+				AssertStatus{Request: req, Expected: 200},
+				AssertJSONPath{Request: req, Path: "$.name", Expected: "alice"},
+			}
+		})
+		if results[1].Result != ettt.CommandAssertionError {
+			t.Fatalf("failed test %#v", results[1])
+		}
+		if results[2].Result != ettt.CommandFailure {
+			t.Fatalf("failed test %#v", results[2])
+		}
+	})
+}
+
+/*
+TestValidateJSONSchema JSON Schemaによる検証
+*/
+func TestValidateJSONSchema(t *testing.T) {
+	schema, _ := decodeJSON([]byte(`{"type":"object","required":["id"],"additionalProperties":false,
+		"properties":{"id":{"type":"integer","minimum":1},"tags":{"type":"array","maxItems":1}}}`))
+	document, _ := decodeJSON([]byte(`{"id":0,"tags":["a","b"],"extra":true}`))
+	violations := ValidateJSONSchema(schema, document)
+	if len(violations) != 3 {
+		t.Fatalf("failed test %v", violations)
+	}
+}
@@ -0,0 +1,158 @@
+package http
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+)
+
+/*
+ValidateJSONSchema
+JSON Schemaでドキュメントを検証し、違反内容のリストを返却する.
+対応するキーワードは以下のサブセット.
+
+	type, enum, const,
+	properties, required, additionalProperties(bool),
+	items, minItems, maxItems,
+	minLength, maxLength, pattern,
+	minimum, maximum
+*/
+func ValidateJSONSchema(schema any, document any) []string {
+	var violations []string
+	validateSchema(schema, document, "$", &violations)
+	return violations
+}
+
+func validateSchema(schema any, value any, path string, violations *[]string) {
+	s, ok := schema.(map[string]any)
+	if !ok {
+		return
+	}
+	report := func(format string, args ...any) {
+		*violations = append(*violations, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if t, ok := s["type"]; ok && !matchSchemaType(t, value) {
+		report("type expected %v, actual %s", t, jsonType(value))
+		return
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("value %v is not in enum %v", value, enum)
+		}
+	}
+	if c, ok := s["const"]; ok && !reflect.DeepEqual(c, value) {
+		report("value %v is not const %v", value, c)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := s["properties"].(map[string]any)
+		if required, ok := s["required"].([]any); ok {
+			for _, r := range required {
+				if name, ok := r.(string); ok {
+					if _, ok := v[name]; !ok {
+						report("required property %s is missing", name)
+					}
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, ok := properties[k]; ok {
+				validateSchema(p, v[k], path+"."+k, violations)
+			} else if additional, ok := s["additionalProperties"].(bool); ok && !additional {
+				report("additional property %s is not allowed", k)
+			}
+		}
+	case []any:
+		if min, ok := schemaNumber(s, "minItems"); ok && float64(len(v)) < min {
+			report("items length %d is less than %v", len(v), min)
+		}
+		if max, ok := schemaNumber(s, "maxItems"); ok && float64(len(v)) > max {
+			report("items length %d is greater than %v", len(v), max)
+		}
+		if items, ok := s["items"]; ok {
+			for i, item := range v {
+				validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if min, ok := schemaNumber(s, "minLength"); ok && length < min {
+			report("length %v is less than %v", length, min)
+		}
+		if max, ok := schemaNumber(s, "maxLength"); ok && length > max {
+			report("length %v is greater than %v", length, max)
+		}
+		if pattern, ok := s["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				report("invalid pattern %s", pattern)
+			} else if !re.MatchString(v) {
+				report("value %q does not match pattern %s", v, pattern)
+			}
+		}
+	case float64:
+		if min, ok := schemaNumber(s, "minimum"); ok && v < min {
+			report("value %v is less than %v", v, min)
+		}
+		if max, ok := schemaNumber(s, "maximum"); ok && v > max {
+			report("value %v is greater than %v", v, max)
+		}
+	}
+}
+
+func matchSchemaType(t any, value any) bool {
+	switch tt := t.(type) {
+	case string:
+		actual := jsonType(value)
+		return actual == tt || (tt == "number" && actual == "integer")
+	case []any:
+		for _, v := range tt {
+			if matchSchemaType(v, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func schemaNumber(s map[string]any, key string) (float64, bool) {
+	v, ok := s[key].(float64)
+	return v, ok
+}
@@ -1,11 +1,20 @@
 package ettt
 
 const (
-	// ExitCodeNormal                  int    = 0
-	// ExitCodeError                   int    = 9
+	ExitCodeNormal                  int    = 0
+	ExitCodeAssertionError          int    = 1
+	ExitCodeUsageError              int    = 2
+	ExitCodeError                   int    = 9
+	DefaultResultPath               string = "results"
 	DefaultReportTemplateDirPath    string = "template"
 	DefaultReportTemplateResultPath string = "result.html"
+	DefaultReportTemplateIndexPath  string = "index.html"
+	DefaultJUnitReportPath          string = "junit.xml"
+	DefaultManifestPath             string = "result.json"
+	ManifestVersion                 int    = 1
 	ScopeNameProfile                string = "profile"
 	ScopeNameStore                  string = "store"
+	ScopeNameGlobal                 string = "global"
+	ScopeNameData                   string = "data"
 	VariableScopeSeparator          string = "."
 )
@@ -1,8 +1,12 @@
 package ettt
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	"log/slog"
+	"slices"
 	"time"
 )
 
@@ -15,6 +19,10 @@ const (
 	ScenarioSuccess        = ScenarioResultStatus("ScenarioSuccess")
 	ScenarioFailure        = ScenarioResultStatus("ScenarioFailure")
 	ScenarioAssertionError = ScenarioResultStatus("ScenarioAssertionError")
+	// ScenarioNotRun タグ選択式などにより実行対象外となったシナリオ
+	ScenarioNotRun = ScenarioResultStatus("ScenarioNotRun")
+	// ScenarioSkipped 前提シナリオが成功しなかったため実行しなかったシナリオ
+	ScenarioSkipped = ScenarioResultStatus("ScenarioSkipped")
 )
 
 type ScenarioPhase string
@@ -26,6 +34,46 @@ const (
 	ScenarioPhaseTearDown = ScenarioPhase("TearDown")
 )
 
+/*
+ScenarioPhases
+実行順に並べたPhaseリスト.
+*/
+var ScenarioPhases = []ScenarioPhase{
+	ScenarioPhaseSetup,
+	ScenarioPhaseExercise,
+	ScenarioPhaseVerify,
+	ScenarioPhaseTearDown,
+}
+
+/*
+PhaseError
+シナリオのPhase実行時に発生したエラー.
+*/
+type PhaseError struct {
+	Phase ScenarioPhase
+	Err   error
+}
+
+func (e *PhaseError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Phase, e.Err)
+}
+
+func (e *PhaseError) Unwrap() error {
+	return e.Err
+}
+
+/*
+ScenarioAttemptResult
+リトライしたシナリオの試行結果.
+*/
+type ScenarioAttemptResult struct {
+	Attempt int
+	Status  ScenarioResultStatus
+	Err     error
+	Start   time.Time
+	End     time.Time
+}
+
 /*
 ExtensionContext 拡張機能用の情報を保持するコンテキスト.
 */
@@ -41,32 +89,118 @@ type GlobalContext struct {
 	options Options
 	// 拡張機能コンテキスト
 	extensions map[string]ExtensionContext
+	// 拡張機能コンテキストの登録順. フックの呼び出し順に利用する.
+	extensionOrder []ExtensionContext
+	// 拡張機能のフックで発生したエラー
+	extensionErrors *extensionErrors
+	// 拡張機能が追加する変数式の関数. 拡張機能の初期化後に作成する.
+	functions map[string]VariableFunction
 	// プロファイル
 	profile Profile
 	// 実行シナリオリスト
 	scenarios []ExecuteScenario
+	// 実行毎の結果ディレクトリ
+	executionResultDir string
+	// シナリオ間で共有するGlobal変数
+	globalStore *StoreVariables
 	// 開始時間
 	start time.Time
 	// 終了時間
 	end time.Time
 }
 
+/*
+Options
+実行オプションを取得.
+*/
+func (gc GlobalContext) Options() Options {
+	return gc.options
+}
+
+/*
+Profile
+読み込んだProfileを取得.
+*/
+func (gc GlobalContext) Profile() Profile {
+	return gc.profile
+}
+
+/*
+Scenarios
+実行シナリオリストを取得.
+*/
+func (gc GlobalContext) Scenarios() []ExecuteScenario {
+	return gc.scenarios
+}
+
+/*
+ResultStatus
+全シナリオの実行結果を集約したステータスを取得.
+ScenarioFailure > ScenarioAssertionError > ScenarioSuccess の優先度で判定する.
+ScenarioNotRun・ScenarioSkippedのシナリオは判定に含めない.
+*/
+func (gc GlobalContext) ResultStatus() ScenarioResultStatus {
+	status := ScenarioSuccess
+	for _, v := range gc.scenarios {
+		switch v.scenarioResultStatus {
+		case ScenarioFailure:
+			return ScenarioFailure
+		case ScenarioAssertionError:
+			status = ScenarioAssertionError
+		}
+	}
+	return status
+}
+
+/*
+ExecutionResultDir
+実行毎の結果ディレクトリを取得.
+*/
+func (gc GlobalContext) ExecutionResultDir() string {
+	return gc.executionResultDir
+}
+
+/*
+Start
+実行開始時間を取得.
+*/
+func (gc GlobalContext) Start() time.Time {
+	return gc.start
+}
+
+/*
+End
+実行終了時間を取得.
+*/
+func (gc GlobalContext) End() time.Time {
+	return gc.end
+}
+
 /*
 RegistrationExtensionContext
 拡張機能コンテキストを登録する.
 外部から変更不可としている.
 キーはその拡張コンテキストが知っている自身のキー.
-TODO : for duplicate key action...
+登録済みのキーの場合は上書きせずにエラーを返却する.
 */
-func (gc *GlobalContext) RegistrationExtensionContext(name string, extensionContext ExtensionContext) {
+func (gc *GlobalContext) RegistrationExtensionContext(name string, extensionContext ExtensionContext) error {
+	if _, ok := gc.extensions[name]; ok {
+		slog.Error("duplicate extension key.", "key", name)
+		return fmt.Errorf("duplicate extension key : %s", name)
+	}
+	if gc.extensions == nil {
+		gc.extensions = make(map[string]ExtensionContext)
+	}
 	gc.extensions[name] = extensionContext
+	gc.extensionOrder = append(gc.extensionOrder, extensionContext)
+	return nil
 }
 
 /*
 GetExtensionContext
 拡張機能コンテキストを取得.
-キーはその拡張コンテキストが知っている自身のキー
-TODO : for duplicate key action...
+キーはその拡張コンテキストが知っている自身のキー.
+型を指定して取得する場合はExtension・ExtensionByKeyを利用する.
 */
 func (gc *GlobalContext) GetExtensionContext(name string) ExtensionContext {
 	return gc.extensions[name]
@@ -77,12 +211,43 @@ Options
 実行オプション
 */
 type Options struct {
-	Profile     string
-	ProfilePath string
+	// Profile名. カンマ区切りで複数指定した場合は指定順にマージする.
+	Profile     string `json:"profile"`
+	ProfilePath string `json:"profilePath"`
+	// Profile変数の上書き.
+	ProfileOverrides map[string]string `json:"-"`
+	// Profile変数の暗号化キーファイルパス.
+	SecretKeyFile string `json:"secretKeyFile"`
 	// 結果出力パス.
-	ResultPath string
+	ResultPath string `json:"resultPath"`
 	// テンプレートディレクトリパス.()
-	TemplateDirPath string
+	TemplateDirPath string `json:"templateDirPath"`
+	// シナリオの最大並列実行数.
+	// 1以下の場合は逐次実行となる.
+	MaxConcurrency int `json:"maxConcurrency"`
+	// Phase毎のタイムアウト.
+	// 0以下の場合はタイムアウトしない.
+	PhaseTimeout time.Duration `json:"phaseTimeout"`
+	// 未解決の変数がある場合の置換モード.
+	// 未指定の場合はReplaceStrictとなる.
+	ReplaceMode ReplaceMode `json:"replaceMode"`
+	// 実行するシナリオ名の正規表現.
+	// 未指定の場合は全てのシナリオを実行する.
+	RunExpression string `json:"runExpression"`
+	// 実行しないシナリオ名の正規表現.
+	SkipExpression string `json:"skipExpression"`
+	// 実行するシナリオのタグ選択式（smoke && !slow など）.
+	// 未指定の場合は全てのシナリオを実行する.
+	TagExpression string `json:"tagExpression"`
+	// Commandのリトライポリシー.
+	// RetryableCommandを実装したCommandはそちらを優先する.
+	CommandRetry RetryPolicy `json:"commandRetry"`
+	// Scenarioのリトライポリシー.
+	// RetryableScenarioを実装したScenarioはそちらを優先する.
+	ScenarioRetry RetryPolicy `json:"scenarioRetry"`
+	// 実行イベントを購読するReporter.
+	// nilの場合はDefaultReportersとなる.
+	Reporters []Reporter `json:"-"`
 }
 
 func DefaultOptions() Options {
@@ -106,6 +271,12 @@ ScenarioContext
 type ScenarioContext struct {
 	// 実行ID
 	id uuid.UUID
+	// シナリオリスト上のインデックス
+	index int
+	// シナリオ用ロガー
+	logger *slog.Logger
+	// 実行中Phaseのコンテキスト
+	ctx context.Context
 	// 開始時間
 	start time.Time
 	// 終了時間
@@ -122,12 +293,34 @@ type ScenarioContext struct {
 	detailsDir string
 	// シナリオ名
 	scenarioName string
+	// シナリオのメタデータ
+	metadata ScenarioMetadata
+	// 前提とするシナリオ名
+	dependsOn []string
 	// シナリオステータス
 	scenarioResultStatus ScenarioResultStatus
 	// エラー
 	error error
+	// 実行しなかった理由
+	skipReason string
+	// 現在のシナリオの試行回数（1始まり）
+	attempt int
+	// リトライしたシナリオの試行結果
+	attempts []ScenarioAttemptResult
+	// リトライ後に成功したか
+	flaky bool
+	// Phase毎に発生したエラー
+	phaseErrors []*PhaseError
+	// クリーンアップスタック
+	cleanups []cleanup
+	// Runで実行中のコマンド結果
+	running *CommandResult
+	// シナリオのイベントを発行する関数
+	publish func(event Event)
 	// Store変数
-	Store StoreVariables
+	store *StoreVariables
+	// データ駆動シナリオの場合に割り当てられたデータ行
+	data *DataRow
 	// 現在のPhase
 	phase ScenarioPhase
 	// SetUpフェーズのCommand実行結果
@@ -142,9 +335,40 @@ type ScenarioContext struct {
 
 /*
 RegistrationCommandResult
-コマンド実行結果を登録
+コマンド実行結果を登録.
+Runによるコマンド実行中に呼び出された場合は、実行中コマンドの結果に統合する.
 */
 func (sc *ScenarioContext) RegistrationCommandResult(commandResult CommandResult) {
+	if sc.running != nil {
+		sc.running.merge(commandResult)
+		return
+	}
+	sc.appendCommandResult(commandResult)
+}
+
+/*
+RegistrationCommandFailure
+コマンド異常終了（CommandFailure）として実行結果を登録し、警告ログを出力する.
+*/
+func (sc *ScenarioContext) RegistrationCommandFailure(message string, err error) {
+	sc.Logger().Warn(message, "error", err)
+	sc.RegistrationCommandResult(CommandResult{
+		Result:  CommandFailure,
+		Message: message,
+		Error:   err,
+	})
+}
+
+/*
+appendCommandResult
+現在のPhaseのコマンド実行結果リストに追加し、EventCommandResultを発行する.
+*/
+func (sc *ScenarioContext) appendCommandResult(commandResult CommandResult) {
+	commandResult = maskCommandResult(commandResult)
+	if 0 == commandResult.Attempt {
+		commandResult.Attempt = 1
+	}
+	commandResult.ScenarioAttempt = sc.attempt
 	switch sc.phase {
 	case ScenarioPhaseSetup:
 		sc.setUpPhaseResults = append(sc.setUpPhaseResults, commandResult)
@@ -155,22 +379,289 @@ func (sc *ScenarioContext) RegistrationCommandResult(commandResult CommandResult
 	case ScenarioPhaseTearDown:
 		sc.tearDownPhaseResults = append(sc.tearDownPhaseResults, commandResult)
 	default:
-		fmt.Errorf("unknown scenario phase %s", sc.phase)
+		slog.Error("unknown scenario phase.", "phase", sc.phase)
 	}
+	sc.publishEvent(Event{Type: EventCommandResult, CommandResult: &commandResult})
 }
 
 /*
-CurrentPhase
-シナリオの現在Phaseを取得
+resetAttempt
+シナリオのリトライに備えて、前回の試行の状態を初期化する.
+コマンド実行結果はリトライ済みとして保持し、Store変数は破棄する.
 */
-func (sc ScenarioContext) CurrentPhase() ScenarioPhase {
-	return sc.phase
+func (sc *ScenarioContext) resetAttempt() {
+	for _, results := range [][]CommandResult{sc.setUpPhaseResults, sc.exercisePhaseResults, sc.verifyPhaseResults, sc.tearDownPhaseResults} {
+		for i := range results {
+			results[i].Retried = true
+		}
+	}
+	sc.scenarioResultStatus = ""
+	sc.error = nil
+	sc.phaseErrors = nil
+	sc.store = NewStoreVariables()
+}
+
+/*
+forkPhase
+Phaseを実行するゴルーチン用にシナリオコンテキストを複製する.
+コマンド実行結果・クリーンアップ・Store変数は複製側にのみ追加されるよう、元と共有しない.
+*/
+func (sc *ScenarioContext) forkPhase() *ScenarioContext {
+	fork := *sc
+	fork.setUpPhaseResults = slices.Clip(sc.setUpPhaseResults)
+	fork.exercisePhaseResults = slices.Clip(sc.exercisePhaseResults)
+	fork.verifyPhaseResults = slices.Clip(sc.verifyPhaseResults)
+	fork.tearDownPhaseResults = slices.Clip(sc.tearDownPhaseResults)
+	fork.cleanups = slices.Clip(sc.cleanups)
+	fork.store = sc.Store().clone()
+	fork.running = nil
+	return &fork
+}
+
+/*
+joinPhase
+終了したPhaseの複製から、Phase中に更新された内容を反映する.
+*/
+func (sc *ScenarioContext) joinPhase(fork *ScenarioContext) {
+	sc.setUpPhaseResults = fork.setUpPhaseResults
+	sc.exercisePhaseResults = fork.exercisePhaseResults
+	sc.verifyPhaseResults = fork.verifyPhaseResults
+	sc.tearDownPhaseResults = fork.tearDownPhaseResults
+	sc.cleanups = fork.cleanups
+	sc.store = fork.store
+}
+
+/*
+hasRetriedResult
+リトライにより置き換えられたコマンド実行結果を含むか.
+*/
+func (sc *ScenarioContext) hasRetriedResult() bool {
+	for _, phase := range ScenarioPhases {
+		for _, r := range sc.PhaseResults(phase) {
+			if r.Retried {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+Id
+シナリオの実行IDを取得.
+*/
+func (sc *ScenarioContext) Id() uuid.UUID {
+	return sc.id
+}
+
+/*
+Index
+シナリオリスト上のインデックスを取得.
+*/
+func (sc *ScenarioContext) Index() int {
+	return sc.index
+}
+
+/*
+ScenarioName
+シナリオ名を取得.
+*/
+func (sc *ScenarioContext) ScenarioName() string {
+	return sc.scenarioName
+}
+
+/*
+Metadata
+シナリオのメタデータを取得.
+*/
+func (sc *ScenarioContext) Metadata() ScenarioMetadata {
+	return sc.metadata
+}
+
+/*
+DependsOn
+前提とするシナリオ名を取得.
+*/
+func (sc *ScenarioContext) DependsOn() []string {
+	return sc.dependsOn
+}
+
+/*
+Attempt
+シナリオの試行回数を取得.
+*/
+func (sc *ScenarioContext) Attempt() int {
+	return sc.attempt
+}
+
+/*
+Attempts
+リトライしたシナリオの試行結果を取得.
+最後の試行の結果は含まない.
+*/
+func (sc *ScenarioContext) Attempts() []ScenarioAttemptResult {
+	return sc.attempts
+}
+
+/*
+Flaky
+シナリオまたはコマンドのリトライ後に成功したかを取得.
+*/
+func (sc *ScenarioContext) Flaky() bool {
+	return sc.flaky
+}
+
+/*
+SkipReason
+シナリオを実行しなかった理由を取得.
+実行した場合は空文字.
+*/
+func (sc *ScenarioContext) SkipReason() string {
+	return sc.skipReason
+}
+
+/*
+Start
+シナリオの開始時間を取得.
+*/
+func (sc *ScenarioContext) Start() time.Time {
+	return sc.start
+}
+
+/*
+End
+シナリオの終了時間を取得.
+*/
+func (sc *ScenarioContext) End() time.Time {
+	return sc.end
+}
+
+/*
+DurationSeconds
+シナリオの実行時間（秒）を取得.
+*/
+func (sc *ScenarioContext) DurationSeconds() float64 {
+	return sc.durationSeconds
+}
+
+/*
+ResultStatus
+シナリオ実行結果ステータスを取得.
+*/
+func (sc *ScenarioContext) ResultStatus() ScenarioResultStatus {
+	return sc.scenarioResultStatus
+}
+
+/*
+Err
+シナリオ実行時のエラーを取得.
+*/
+func (sc *ScenarioContext) Err() error {
+	return sc.error
+}
+
+/*
+PhaseErrors
+Phase毎に発生したエラーを発生順に取得.
+*/
+func (sc *ScenarioContext) PhaseErrors() []*PhaseError {
+	return sc.phaseErrors
+}
+
+/*
+addPhaseError
+Phaseのエラーを保持.
+*/
+func (sc *ScenarioContext) addPhaseError(phase ScenarioPhase, err error) *PhaseError {
+	phaseError := &PhaseError{Phase: phase, Err: maskError(err)}
+	sc.phaseErrors = append(sc.phaseErrors, phaseError)
+	return phaseError
+}
+
+/*
+joinPhaseErrors
+保持している全Phaseのエラーを1つのエラーにまとめる.
+*/
+func (sc *ScenarioContext) joinPhaseErrors() error {
+	errs := make([]error, 0, len(sc.phaseErrors))
+	for _, v := range sc.phaseErrors {
+		errs = append(errs, v)
+	}
+	return errors.Join(errs...)
+}
+
+/*
+ScenarioResultDir
+シナリオの結果ディレクトリを取得.
+*/
+func (sc *ScenarioContext) ScenarioResultDir() string {
+	return sc.scenarioResultDir
+}
+
+/*
+EvidencesDir
+エビデンス格納ディレクトリを取得.
+*/
+func (sc *ScenarioContext) EvidencesDir() string {
+	return sc.evidencesDir
+}
+
+/*
+DetailsDir
+詳細レポート格納ディレクトリを取得.
+*/
+func (sc *ScenarioContext) DetailsDir() string {
+	return sc.detailsDir
+}
+
+/*
+PhaseResults
+指定したPhaseのCommand実行結果を取得.
+*/
+func (sc *ScenarioContext) PhaseResults(phase ScenarioPhase) []CommandResult {
+	switch phase {
+	case ScenarioPhaseSetup:
+		return sc.setUpPhaseResults
+	case ScenarioPhaseExercise:
+		return sc.exercisePhaseResults
+	case ScenarioPhaseVerify:
+		return sc.verifyPhaseResults
+	case ScenarioPhaseTearDown:
+		return sc.tearDownPhaseResults
+	default:
+		return nil
+	}
 }
 
 /*
-StoreVariables
-ストア変数.
+Context
+実行中Phaseのコンテキストを取得.
+Phaseのタイムアウトや実行全体のキャンセルで終了するため、
+ScenarioやCommandの長時間かかる処理はこのコンテキストを利用すること.
 */
-type StoreVariables struct {
-	Variables map[string]string
+func (sc *ScenarioContext) Context() context.Context {
+	if sc.ctx == nil {
+		return context.Background()
+	}
+	return sc.ctx
+}
+
+/*
+Logger
+シナリオ用のロガーを取得.
+シナリオ名と実行IDが属性として付与されるため、並列実行時もログの識別が可能.
+*/
+func (sc *ScenarioContext) Logger() *slog.Logger {
+	if sc.logger == nil {
+		return slog.Default()
+	}
+	return sc.logger
+}
+
+/*
+CurrentPhase
+シナリオの現在Phaseを取得
+*/
+func (sc ScenarioContext) CurrentPhase() ScenarioPhase {
+	return sc.phase
 }
@@ -0,0 +1,200 @@
+package ettt
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+データ行のラベルとして利用する列名.
+レポート上のシナリオ名・結果ディレクトリ名に付与される. 列がない場合は行番号となる.
+*/
+const DataLabelColumn string = "label"
+
+/*
+DataScenario
+データテーブルの行毎にシナリオを実行する場合に任意で実装するインタフェース.
+行毎に独立したシナリオとして実行され、行の値は ${data.列名} で参照できる.
+全ての行で同一のシナリオの値を共有するため、行は逐次実行する.
+行毎の状態はScenarioContextに保持すること.
+*/
+type DataScenario interface {
+	/*
+		DataFile
+		データテーブルファイルのパス.
+		拡張子（.csv / .yaml, .yml / .json）で形式を判定する.
+	*/
+	DataFile() string
+}
+
+/*
+ParallelDataScenario
+データ駆動シナリオの行を並列に実行する場合に任意で実装するインタフェース.
+ParallelRowsがtrueの場合、行は最大並列実行数の範囲で並列に実行される.
+シナリオのフィールドを変更しないシナリオのみ実装すること.
+*/
+type ParallelDataScenario interface {
+	DataScenario
+	ParallelRows() bool
+}
+
+/*
+parallelRows
+データ駆動シナリオの行を並列に実行するか判定.
+*/
+func parallelRows(s Scenario) bool {
+	if p, ok := s.(ParallelDataScenario); ok {
+		return p.ParallelRows()
+	}
+	return false
+}
+
+/*
+DataRow
+データテーブルの1行.
+*/
+type DataRow struct {
+	// 行番号（0始まり）
+	Index int
+	// ラベル. label列の値、ない場合は行番号.
+	Label string
+	// 列名と値. CSVの場合は全て文字列、YAML・JSONの場合は入れ子のMap・リストも指定できる.
+	Values map[string]any
+}
+
+/*
+Lookup
+変数パス（column, user.name など）で値を取得.
+*/
+func (r DataRow) Lookup(path string) (any, error) {
+	segments, err := parseVariablePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return r.lookup(segments)
+}
+
+func (r DataRow) lookup(segments []variablePathSegment) (any, error) {
+	if segments[0].isIndex {
+		return nil, fmt.Errorf("variable path must start with key")
+	}
+	return lookupVariablePath(r.Values, segments)
+}
+
+/*
+value
+列の値を取得. データ行がない場合は常に存在しない.
+*/
+func (r *DataRow) value(column string) (any, bool) {
+	if r == nil {
+		return nil, false
+	}
+	v, ok := r.Values[column]
+	return v, ok
+}
+
+/*
+GetString
+変数パスで値を文字列として取得.
+*/
+func (r DataRow) GetString(path string) (string, error) {
+	v, err := r.Lookup(path)
+	if err != nil {
+		return "", err
+	}
+	return formatVariableValue(v), nil
+}
+
+/*
+Data
+シナリオに割り当てられたデータ行を取得.
+DataScenarioではない場合はnil.
+*/
+func (sc *ScenarioContext) Data() *DataRow {
+	return sc.data
+}
+
+/*
+LoadDataTable
+データテーブルファイルを読み込む.
+
+	CSV   1行目をヘッダ（列名）とする
+	YAML  列名と値のMapのリスト
+	JSON  列名と値のオブジェクトの配列
+*/
+func LoadDataTable(path string) ([]DataRow, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		records, err = parseCSVDataTable(b)
+	case ".yaml", ".yml":
+		var v []map[string]any
+		err = yaml.Unmarshal(b, &v)
+		records = v
+	case ".json":
+		var v []map[string]any
+		err = json.Unmarshal(b, &v)
+		records = v
+	default:
+		return nil, fmt.Errorf("unknown data table format. path : %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can not parse data table. path : %s. %w", path, err)
+	}
+
+	rows := make([]DataRow, 0, len(records))
+	for i, record := range records {
+		row := DataRow{Index: i, Label: strconv.Itoa(i), Values: make(map[string]any, len(record))}
+		for k, v := range record {
+			row.Values[k] = normalizeVariableValue(v)
+		}
+		if label, ok := row.Values[DataLabelColumn]; ok && "" != formatVariableValue(label) {
+			row.Label = formatVariableValue(label)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+/*
+parseCSVDataTable
+CSVを読み込み、1行目を列名としたMapのリストに変換.
+*/
+func parseCSVDataTable(b []byte) ([]map[string]any, error) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(b), "\ufeff")))
+	lines, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if 0 == len(lines) {
+		return nil, nil
+	}
+	header := lines[0]
+	records := make([]map[string]any, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		record := make(map[string]any, len(header))
+		for i, column := range header {
+			record[strings.TrimSpace(column)] = line[i]
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+/*
+dataScenarioName
+データ行を含むシナリオ名.
+*/
+func dataScenarioName(name string, row DataRow) string {
+	return fmt.Sprintf("%s[%s]", name, row.Label)
+}
@@ -0,0 +1,263 @@
+package ettt
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+dataScenario データテーブルを指定したテスト用シナリオ.
+*/
+type dataScenario struct {
+	funcScenario
+	file string
+}
+
+func (s dataScenario) DataFile() string {
+	return s.file
+}
+
+/*
+statefulDataScenario フィールドに行毎の状態を保持するテスト用データ駆動シナリオ.
+*/
+type statefulDataScenario struct {
+	file     string
+	parallel bool
+	current  string
+	mu       sync.Mutex
+	running  int
+	max      int
+}
+
+func (s *statefulDataScenario) DataFile() string {
+	return s.file
+}
+
+func (s *statefulDataScenario) ParallelRows() bool {
+	return s.parallel
+}
+
+func (s *statefulDataScenario) Setup(gc GlobalContext, sc *ScenarioContext) error {
+	if !s.parallel {
+		s.current = sc.Data().Label
+	}
+	return nil
+}
+
+func (s *statefulDataScenario) Exercise(gc GlobalContext, sc *ScenarioContext) error {
+	s.mu.Lock()
+	s.running++
+	s.max = max(s.max, s.running)
+	s.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	s.mu.Lock()
+	s.running--
+	s.mu.Unlock()
+	if !s.parallel && s.current != sc.Data().Label {
+		return fmt.Errorf("row state is overwritten. expected : %s, actual : %s", sc.Data().Label, s.current)
+	}
+	return nil
+}
+
+func (s *statefulDataScenario) Verify(gc GlobalContext, sc *ScenarioContext) error {
+	return nil
+}
+
+func (s *statefulDataScenario) TearDown(gc GlobalContext, sc *ScenarioContext) error {
+	return nil
+}
+
+/*
+TestLoadDataTable データテーブルの読み込み
+*/
+func TestLoadDataTable(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"rows.csv":  "\ufefflabel, user,count\nalice,Alice,1\n,Bob,2\n",
+		"rows.yaml": "- label: alice\n  user: Alice\n  count: 1\n- user: Bob\n  count: 2\n  tags: [a, b]\n",
+		"rows.json": `[{"label":"alice","user":"Alice","count":1},{"user":"Bob","count":2,"tags":["a","b"]}]`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatalf("failed test %#v", err)
+			}
+			rows, err := LoadDataTable(path)
+			if err != nil {
+				t.Fatalf("failed test %#v", err)
+			}
+			if 2 != len(rows) || "alice" != rows[0].Label || "1" != rows[1].Label || 1 != rows[1].Index {
+				t.Fatalf("failed test %#v", rows)
+			}
+			for i, expected := range []string{"Alice", "Bob"} {
+				if v, err := rows[i].GetString("user"); err != nil || v != expected {
+					t.Fatalf("failed test %s %#v", v, err)
+				}
+				if v, err := rows[i].GetString("count"); err != nil || v != fmt.Sprint(i+1) {
+					t.Fatalf("failed test %s %#v", v, err)
+				}
+			}
+			if ".csv" != filepath.Ext(name) {
+				if v, err := rows[1].GetString("tags[1]"); err != nil || "b" != v {
+					t.Fatalf("failed test %s %#v", v, err)
+				}
+			}
+		})
+	}
+	t.Run("未対応の形式", func(t *testing.T) {
+		path := filepath.Join(dir, "rows.txt")
+		if err := os.WriteFile(path, []byte("label"), 0o644); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if _, err := LoadDataTable(path); err == nil {
+			t.Fatalf("failed test")
+		}
+	})
+}
+
+/*
+TestRunDataScenario データ行毎のシナリオ実行
+*/
+func TestRunDataScenario(t *testing.T) {
+	options := testOptions(t)
+	path := filepath.Join(t.TempDir(), "rows.csv")
+	if err := os.WriteFile(path, []byte("label,user,ok\nalice,Alice,true\nbob/2,Bob,false\n,Carol,true\n"), 0o644); err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+
+	var mu sync.Mutex
+	users := make(map[string]string)
+	scenario := dataScenario{
+		funcScenario: funcScenario{
+			exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+				user, err := Replace(gc, *sc, "${data.user}:${user}:${key1}")
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				users[sc.ScenarioName()] = user
+				mu.Unlock()
+				if ok, err := sc.Data().GetString("ok"); err != nil || "true" != ok {
+					return fmt.Errorf("row %d is ng", sc.Data().Index)
+				}
+				return nil
+			},
+		},
+		file: path,
+	}
+	engine, err := NewNamed([]NamedScenario{{Name: "login", Scenario: scenario}, {Name: "plain", Scenario: funcScenario{
+		exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+			if sc.Data() != nil {
+				return fmt.Errorf("unexpected data row")
+			}
+			if _, err := Replace(gc, *sc, "${data.user}"); err == nil {
+				return fmt.Errorf("unexpected data scope")
+			}
+			return nil
+		},
+	}}}, nil, options)
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	if err := engine.Run(); err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+
+	expected := []struct {
+		name   string
+		user   string
+		status ScenarioResultStatus
+	}{
+		{"login[alice]", "Alice:Alice:value1", ScenarioSuccess},
+		{"login[bob/2]", "Bob:Bob:value1", ScenarioFailure},
+		{"login[2]", "Carol:Carol:value1", ScenarioSuccess},
+		{"plain", "", ScenarioSuccess},
+	}
+	scenarios := engine.Scenarios()
+	if len(expected) != len(scenarios) {
+		t.Fatalf("failed test %d", len(scenarios))
+	}
+	for i, e := range expected {
+		sc := scenarios[i]
+		if sc.Index() != i || sc.ScenarioName() != e.name || sc.ResultStatus() != e.status || users[e.name] != e.user {
+			t.Fatalf("failed test name=%s status=%s error=%v", sc.ScenarioName(), sc.ResultStatus(), sc.Err())
+		}
+		dir := filepath.Base(sc.ScenarioResultDir())
+		if !strings.HasPrefix(dir, resultDirName(e.name)+"_") {
+			t.Fatalf("failed test %s", dir)
+		}
+		manifest := newScenarioManifest(sc.ScenarioContext)
+		if (nil == sc.Data()) != (nil == manifest.Data) {
+			t.Fatalf("failed test %#v", manifest.Data)
+		}
+	}
+
+	t.Run("データ行がない場合は実行対象外として残す", func(t *testing.T) {
+		empty := filepath.Join(t.TempDir(), "empty.csv")
+		if err := os.WriteFile(empty, []byte("label,user\n"), 0o644); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		executed := false
+		engine, err := NewNamed([]NamedScenario{
+			{Name: "login", Scenario: dataScenario{funcScenario: funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+				executed = true
+				return nil
+			}}, file: empty}},
+			{Name: "logout", Scenario: dependentScenario{funcScenario: funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+				executed = true
+				return nil
+			}}, dependsOn: []string{"login"}}},
+		}, nil, options)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		scenarios := engine.Scenarios()
+		if executed || 2 != len(scenarios) || nil != scenarios[0].Data() {
+			t.Fatalf("failed test executed=%t %d", executed, len(scenarios))
+		}
+		if ScenarioNotRun != scenarios[0].ResultStatus() || !strings.Contains(scenarios[0].SkipReason(), "no rows") {
+			t.Fatalf("failed test %s %s", scenarios[0].ResultStatus(), scenarios[0].SkipReason())
+		}
+		if ScenarioSkipped != scenarios[1].ResultStatus() || !strings.Contains(scenarios[1].SkipReason(), "login") {
+			t.Fatalf("failed test %s %s", scenarios[1].ResultStatus(), scenarios[1].SkipReason())
+		}
+	})
+	t.Run("行は逐次実行し、並列実行を許可した場合のみ並列に実行する", func(t *testing.T) {
+		options := testOptions(t)
+		options.MaxConcurrency = 3
+		file := writeDataTable(t, "label\na\nb\nc\n")
+		for _, parallel := range []bool{false, true} {
+			scenario := &statefulDataScenario{file: file, parallel: parallel}
+			engine, err := New([]Scenario{scenario}, nil, options)
+			if err != nil {
+				t.Fatalf("failed test %#v", err)
+			}
+			if err := engine.Run(); err != nil {
+				t.Fatalf("failed test %#v", err)
+			}
+			for _, sc := range engine.Scenarios() {
+				if ScenarioSuccess != sc.ResultStatus() {
+					t.Fatalf("failed test %s %v", sc.ScenarioName(), sc.Err())
+				}
+			}
+			if parallel == (1 == scenario.max) {
+				t.Fatalf("failed test parallel=%t max=%d", parallel, scenario.max)
+			}
+		}
+	})
+	t.Run("データテーブルが読み込めない場合はエラー", func(t *testing.T) {
+		missing := dataScenario{file: filepath.Join(t.TempDir(), "missing.csv")}
+		if _, err := New([]Scenario{missing}, nil, options); err == nil {
+			t.Fatalf("failed test")
+		}
+	})
+}
@@ -0,0 +1,217 @@
+package ettt
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+/*
+ScenarioCycleError
+シナリオの前提関係が循環している.
+*/
+type ScenarioCycleError struct {
+	Chain []string
+}
+
+func (e *ScenarioCycleError) Error() string {
+	return "scenario dependency cycle detected. " + strings.Join(e.Chain, " -> ")
+}
+
+/*
+resolveDependencies
+実行シナリオ毎に前提とする実行シナリオのインデックスを解決し、循環を検出する.
+indexesはシナリオ名と実行シナリオのインデックスの対応.
+*/
+func resolveDependencies(scenarios []ExecuteScenario, indexes map[string][]int) ([][]int, error) {
+	dependencies := make([][]int, len(scenarios))
+	for i, es := range scenarios {
+		for _, name := range es.dependsOn {
+			targets, ok := indexes[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown dependency scenario. name : %s, dependency : %s", es.scenarioName, name)
+			}
+			dependencies[i] = append(dependencies[i], targets...)
+		}
+	}
+
+	// 深さ優先探索で循環を検出する
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(scenarios))
+	var path []int
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			var chain []string
+			for j := len(path) - 1; j >= 0; j-- {
+				if path[j] == i {
+					for _, k := range path[j:] {
+						chain = append(chain, scenarios[k].scenarioName)
+					}
+					break
+				}
+			}
+			return &ScenarioCycleError{Chain: append(chain, scenarios[i].scenarioName)}
+		case visited:
+			return nil
+		}
+		state[i] = visiting
+		path = append(path, i)
+		for _, d := range dependencies[i] {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return nil
+	}
+	for i := range scenarios {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return dependencies, nil
+}
+
+/*
+scenarioScheduler
+前提シナリオが完了したシナリオから順に実行可能とするスケジューラ.
+実行可能なシナリオはシナリオリストの順序で払い出す.
+前提シナリオが成功しなかった場合は実行せずにScenarioSkippedとする.
+ディスパッチを行う単一のゴルーチンから利用する.
+*/
+type scenarioScheduler struct {
+	scenarios    []ExecuteScenario
+	dependencies [][]int
+	// 自身を前提とするシナリオ
+	dependents [][]int
+	// 未完了の前提シナリオ数
+	waiting []int
+	done    []bool
+	// 実行可能なシナリオ（インデックス順）
+	ready    []int
+	finished int
+	// 実行せずに完了としたシナリオ（ScenarioNotRun・ScenarioSkipped）の通知先
+	skipped func(es ExecuteScenario)
+}
+
+/*
+newScenarioScheduler
+スケジューラを生成.
+ScenarioNotRunのシナリオは前提シナリオに関わらず完了として扱う.
+実行せずに完了としたシナリオはskippedに通知する.
+*/
+func newScenarioScheduler(scenarios []ExecuteScenario, dependencies [][]int, skipped func(es ExecuteScenario)) *scenarioScheduler {
+	s := &scenarioScheduler{
+		scenarios:    scenarios,
+		dependencies: dependencies,
+		dependents:   make([][]int, len(scenarios)),
+		waiting:      make([]int, len(scenarios)),
+		done:         make([]bool, len(scenarios)),
+		skipped:      skipped,
+	}
+	for i := range dependencies {
+		s.waiting[i] = len(dependencies[i])
+		for _, d := range dependencies[i] {
+			s.dependents[d] = append(s.dependents[d], i)
+		}
+	}
+	for i, es := range scenarios {
+		if ScenarioNotRun == es.scenarioResultStatus {
+			slog.Info("scenario not run.", "index", es.index, "name", es.scenarioName, "reason", es.skipReason)
+			s.skip(i)
+		}
+	}
+	for i := range scenarios {
+		if 0 == s.waiting[i] {
+			s.release(i)
+		}
+	}
+	return s
+}
+
+/*
+release
+前提シナリオが全て完了したシナリオを実行可能にする.
+*/
+func (s *scenarioScheduler) release(i int) {
+	if s.done[i] {
+		return
+	}
+	es := s.scenarios[i]
+	for _, d := range s.dependencies[i] {
+		if status := s.scenarios[d].scenarioResultStatus; ScenarioSuccess != status {
+			es.scenarioResultStatus = ScenarioSkipped
+			es.skipReason = fmt.Sprintf("dependency %s was not successful. status : %s", s.scenarios[d].scenarioName, status)
+			slog.Info("scenario skipped.", "index", es.index, "name", es.scenarioName, "reason", es.skipReason)
+			s.skip(i)
+			return
+		}
+	}
+	at := sort.SearchInts(s.ready, i)
+	s.ready = append(s.ready, 0)
+	copy(s.ready[at+1:], s.ready[at:])
+	s.ready[at] = i
+}
+
+/*
+skip
+実行しなかったシナリオを完了とし、通知する.
+*/
+func (s *scenarioScheduler) skip(i int) {
+	if s.done[i] {
+		return
+	}
+	if s.skipped != nil {
+		s.skipped(s.scenarios[i])
+	}
+	s.complete(i)
+}
+
+/*
+complete
+シナリオの完了を記録し、自身を前提とするシナリオの待ちを解除する.
+*/
+func (s *scenarioScheduler) complete(i int) {
+	if s.done[i] {
+		return
+	}
+	s.done[i] = true
+	s.finished++
+	for _, d := range s.dependents[i] {
+		if s.waiting[d]--; 0 == s.waiting[d] {
+			s.release(d)
+		}
+	}
+}
+
+/*
+next
+次に実行可能なシナリオを取得.
+払い出し済みとするにはpopを呼び出す.
+*/
+func (s *scenarioScheduler) next() (int, bool) {
+	if 0 == len(s.ready) {
+		return 0, false
+	}
+	return s.ready[0], true
+}
+
+func (s *scenarioScheduler) pop() {
+	s.ready = s.ready[1:]
+}
+
+/*
+completed
+全てのシナリオが完了したか.
+*/
+func (s *scenarioScheduler) completed() bool {
+	return s.finished == len(s.scenarios)
+}
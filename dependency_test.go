@@ -0,0 +1,241 @@
+package ettt
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+dependentScenario 前提シナリオを指定したテスト用シナリオ.
+*/
+type dependentScenario struct {
+	funcScenario
+	dependsOn []string
+	tags      []string
+}
+
+func (s dependentScenario) DependsOn() []string {
+	return s.dependsOn
+}
+
+func (s dependentScenario) Metadata() ScenarioMetadata {
+	return ScenarioMetadata{Tags: s.tags}
+}
+
+/*
+eventRecorder シナリオの開始・終了の順序を記録する.
+*/
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *eventRecorder) scenario(err error, dependsOn ...string) dependentScenario {
+	return dependentScenario{
+		funcScenario: funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+			r.record("start " + sc.ScenarioName())
+			time.Sleep(10 * time.Millisecond)
+			r.record("end " + sc.ScenarioName())
+			return err
+		}},
+		dependsOn: dependsOn,
+	}
+}
+
+func (r *eventRecorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) position(event string) int {
+	for i, e := range r.events {
+		if e == event {
+			return i
+		}
+	}
+	return -1
+}
+
+/*
+TestRunDependencies 前提関係に従ったシナリオの実行
+*/
+func TestRunDependencies(t *testing.T) {
+	t.Run("前提シナリオの完了後に実行し、失敗した場合は後続をスキップする", func(t *testing.T) {
+		r := &eventRecorder{}
+		options := testOptions(t)
+		options.MaxConcurrency = 4
+		engine, err := NewNamed([]NamedScenario{
+			{Name: "invite", Scenario: r.scenario(nil, "tenant")},
+			{Name: "tenant", Scenario: r.scenario(nil)},
+			{Name: "broken", Scenario: r.scenario(errors.New("boom"))},
+			{Name: "afterBroken", Scenario: r.scenario(nil, "broken", "tenant")},
+			{Name: "chain", Scenario: r.scenario(nil, "afterBroken")},
+			{Name: "independent", Scenario: r.scenario(nil)},
+		}, nil, options)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+
+		expected := []ScenarioResultStatus{ScenarioSuccess, ScenarioSuccess, ScenarioFailure, ScenarioSkipped, ScenarioSkipped, ScenarioSuccess}
+		for i, es := range engine.Scenarios() {
+			if es.ResultStatus() != expected[i] {
+				t.Fatalf("failed test name=%s status=%s", es.ScenarioName(), es.ResultStatus())
+			}
+		}
+		if r.position("end tenant") > r.position("start invite") || 0 <= r.position("start afterBroken") || 0 <= r.position("start chain") {
+			t.Fatalf("failed test %v", r.events)
+		}
+		if !strings.Contains(engine.Scenarios()[3].SkipReason(), "broken") || !strings.Contains(engine.Scenarios()[4].SkipReason(), "afterBroken") {
+			t.Fatalf("failed test %s %s", engine.Scenarios()[3].SkipReason(), engine.Scenarios()[4].SkipReason())
+		}
+		// 前提関係のないシナリオは並列に実行される
+		if r.position("start independent") > r.position("end tenant") {
+			t.Fatalf("failed test %v", r.events)
+		}
+		if ScenarioFailure != engine.ResultStatus() {
+			t.Fatalf("failed test %s", engine.ResultStatus())
+		}
+	})
+	t.Run("逐次実行では前提関係を満たす範囲で定義順に実行する", func(t *testing.T) {
+		r := &eventRecorder{}
+		engine, err := NewNamed([]NamedScenario{
+			{Name: "c", Scenario: r.scenario(nil, "b")},
+			{Name: "a", Scenario: r.scenario(nil)},
+			{Name: "b", Scenario: r.scenario(nil, "a")},
+			{Name: "d", Scenario: r.scenario(nil)},
+		}, nil, testOptions(t))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		var order []string
+		for _, e := range r.events {
+			if name, ok := strings.CutPrefix(e, "start "); ok {
+				order = append(order, name)
+			}
+		}
+		if !reflect.DeepEqual(order, []string{"a", "b", "c", "d"}) {
+			t.Fatalf("failed test %v", order)
+		}
+	})
+	t.Run("実行対象外の前提シナリオ", func(t *testing.T) {
+		r := &eventRecorder{}
+		options := testOptions(t)
+		options.TagExpression = "!slow"
+		slow := r.scenario(nil)
+		slow.tags = []string{"slow"}
+		engine, err := NewNamed([]NamedScenario{
+			{Name: "slow", Scenario: slow},
+			{Name: "after", Scenario: r.scenario(nil, "slow")},
+		}, nil, options)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if s := engine.Scenarios(); ScenarioNotRun != s[0].ResultStatus() || ScenarioSkipped != s[1].ResultStatus() || 0 != len(r.events) {
+			t.Fatalf("failed test %s %s %v", s[0].ResultStatus(), s[1].ResultStatus(), r.events)
+		}
+	})
+	t.Run("シナリオ名の正規表現で選択されない前提シナリオ", func(t *testing.T) {
+		r := &eventRecorder{}
+		options := testOptions(t)
+		options.RunExpression = "^after"
+		options.SkipExpression = "_slow$"
+		engine, err := NewNamed([]NamedScenario{
+			{Name: "login", Scenario: r.scenario(nil)},
+			{Name: "after", Scenario: r.scenario(nil, "login")},
+			{Name: "after_slow", Scenario: r.scenario(nil)},
+		}, nil, options)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		s := engine.Scenarios()
+		if ScenarioNotRun != s[0].ResultStatus() || ScenarioSkipped != s[1].ResultStatus() || ScenarioNotRun != s[2].ResultStatus() || 0 != len(r.events) {
+			t.Fatalf("failed test %s %s %s %v", s[0].ResultStatus(), s[1].ResultStatus(), s[2].ResultStatus(), r.events)
+		}
+		if !strings.Contains(s[0].SkipReason(), "name expression") {
+			t.Fatalf("failed test %s", s[0].SkipReason())
+		}
+		options.RunExpression = "("
+		if _, err := NewNamed([]NamedScenario{{Name: "login", Scenario: r.scenario(nil)}}, nil, options); err == nil {
+			t.Fatal("failed test")
+		}
+	})
+	t.Run("データ駆動シナリオの全ての行を前提とする", func(t *testing.T) {
+		r := &eventRecorder{}
+		rows := dataScenario{funcScenario: r.scenario(nil).funcScenario, file: writeDataTable(t, "label\na\nb\n")}
+		options := testOptions(t)
+		options.MaxConcurrency = 3
+		engine, err := NewNamed([]NamedScenario{
+			{Name: "after", Scenario: r.scenario(nil, "rows")},
+			{Name: "rows", Scenario: rows},
+		}, nil, options)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		start := r.position("start after")
+		if start < r.position("end rows[a]") || start < r.position("end rows[b]") {
+			t.Fatalf("failed test %v", r.events)
+		}
+	})
+}
+
+/*
+TestResolveDependencies 前提関係の解決と循環の検出
+*/
+func TestResolveDependencies(t *testing.T) {
+	r := &eventRecorder{}
+	t.Run("循環", func(t *testing.T) {
+		_, err := NewNamed([]NamedScenario{
+			{Name: "a", Scenario: r.scenario(nil, "c")},
+			{Name: "b", Scenario: r.scenario(nil, "a")},
+			{Name: "c", Scenario: r.scenario(nil, "b")},
+		}, nil, testOptions(t))
+		var cycle *ScenarioCycleError
+		if !errors.As(err, &cycle) || "a -> c -> b -> a" != strings.Join(cycle.Chain, " -> ") {
+			t.Fatalf("failed test %v", err)
+		}
+		_, err = NewNamed([]NamedScenario{{Name: "self", Scenario: r.scenario(nil, "self")}}, nil, testOptions(t))
+		if !errors.As(err, &cycle) {
+			t.Fatalf("failed test %v", err)
+		}
+	})
+	t.Run("存在しない前提シナリオ", func(t *testing.T) {
+		_, err := NewNamed([]NamedScenario{{Name: "a", Scenario: r.scenario(nil, "missing")}}, nil, testOptions(t))
+		if err == nil || !strings.Contains(err.Error(), "missing") {
+			t.Fatalf("failed test %v", err)
+		}
+	})
+}
+
+/*
+writeDataTable テスト用のCSVデータテーブルを作成.
+*/
+func writeDataTable(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rows.csv")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed write data table %#v", err)
+	}
+	return path
+}
@@ -0,0 +1,321 @@
+package ettt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+/*
+ReplaceValue 構造化された値の変数置換.
+Map（map[string]any）・リスト（[]any）を辿り、全ての文字列の値を置換した新しい値を返却する.
+Mapのキーは置換しない.
+keepTypeがtrueの場合、文字列全体が1つの変数（"${store.count}" など）であれば変数の値の型を保つ.
+*/
+func ReplaceValue(gc GlobalContext, sc ScenarioContext, value any, keepType bool) (any, error) {
+	w := documentReplacer{r: variableReplacer{gc: gc, sc: sc, mode: gc.options.ReplaceMode}, keepType: keepType}
+	v := w.value(value, "$")
+	return v, errors.Join(w.errs...)
+}
+
+/*
+ReplaceJSON JSONドキュメントの変数置換.
+キーの順序は保ち、文字列の値のみを置換する. 出力は空白を含まない形式となる.
+*/
+func ReplaceJSON(gc GlobalContext, sc ScenarioContext, data []byte, keepType bool) ([]byte, error) {
+	w := documentReplacer{r: variableReplacer{gc: gc, sc: sc, mode: gc.options.ReplaceMode}, keepType: keepType}
+	out, err := w.jsonDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	return out, errors.Join(w.errs...)
+}
+
+/*
+ReplaceYAML YAMLドキュメントの変数置換.
+キーの順序・コメントは保ち、文字列のスカラー値のみを置換する.
+*/
+func ReplaceYAML(gc GlobalContext, sc ScenarioContext, data []byte, keepType bool) ([]byte, error) {
+	w := documentReplacer{r: variableReplacer{gc: gc, sc: sc, mode: gc.options.ReplaceMode}, keepType: keepType}
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		w.yamlNode(&node, "$")
+		if err := encoder.Encode(&node); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), errors.Join(w.errs...)
+}
+
+/*
+ReplaceInto Goの値の変数置換.
+ポインタで渡された構造体・Map・スライスを辿り、文字列の値を直接置換する.
+非公開フィールドは対象外. any型の値はReplaceValueと同様に置換する.
+*/
+func ReplaceInto(gc GlobalContext, sc ScenarioContext, ptr any, keepType bool) error {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("replace target must be non-nil pointer. type : %T", ptr)
+	}
+	w := documentReplacer{r: variableReplacer{gc: gc, sc: sc, mode: gc.options.ReplaceMode}, keepType: keepType}
+	w.goValue(rv.Elem(), "$")
+	return errors.Join(w.errs...)
+}
+
+/*
+documentReplacer
+ドキュメントを辿って文字列の値を置換する.
+エラーは値の位置（$.users[0].name 形式）を付与して全て保持する.
+*/
+type documentReplacer struct {
+	r        variableReplacer
+	keepType bool
+	errs     []error
+}
+
+/*
+text
+文字列の値を置換.
+*/
+func (w *documentReplacer) text(s string, path string) any {
+	var v any
+	var err error
+	if w.keepType {
+		v, err = w.r.replaceValue(s)
+	} else {
+		v, err = w.r.replace(s, nil)
+	}
+	if err != nil {
+		w.errs = append(w.errs, fmt.Errorf("%s: %w", path, err))
+	}
+	return v
+}
+
+func (w *documentReplacer) value(value any, path string) any {
+	switch v := value.(type) {
+	case string:
+		return w.text(v, path)
+	case map[string]any:
+		replaced := make(map[string]any, len(v))
+		for k, e := range v {
+			replaced[k] = w.value(e, documentPath(path, k))
+		}
+		return replaced
+	case []any:
+		replaced := make([]any, 0, len(v))
+		for i, e := range v {
+			replaced = append(replaced, w.value(e, fmt.Sprintf("%s[%d]", path, i)))
+		}
+		return replaced
+	}
+	return value
+}
+
+/*
+jsonDocument
+JSONをトークン単位で走査し、文字列の値を置換して出力する.
+*/
+func (w *documentReplacer) jsonDocument(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	write := func(v any) error {
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		// Encodeが付与する改行を除去する
+		out.Truncate(out.Len() - 1)
+		return nil
+	}
+
+	// 入れ子のオブジェクト・配列毎の要素数とパス
+	type frame struct {
+		object bool
+		count  int
+		path   string
+		key    string
+	}
+	var stack []*frame
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		path := "$"
+		if 0 < len(stack) {
+			top := stack[len(stack)-1]
+			if d, ok := token.(json.Delim); ok && ('}' == d || ']' == d) {
+				out.WriteByte(byte(d))
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			if top.object && 0 == top.count%2 {
+				// オブジェクトのキー
+				if 0 < top.count {
+					out.WriteByte(',')
+				}
+				top.key = token.(string)
+				top.count++
+				if err := write(top.key); err != nil {
+					return nil, err
+				}
+				out.WriteByte(':')
+				continue
+			}
+			if top.object {
+				path = documentPath(top.path, top.key)
+			} else {
+				if 0 < top.count {
+					out.WriteByte(',')
+				}
+				path = fmt.Sprintf("%s[%d]", top.path, top.count)
+			}
+			top.count++
+		} else if 0 < out.Len() {
+			out.WriteByte('\n')
+		}
+
+		switch t := token.(type) {
+		case json.Delim:
+			out.WriteByte(byte(t))
+			stack = append(stack, &frame{object: '{' == t, path: path})
+		case string:
+			if err := write(w.text(t, path)); err != nil {
+				return nil, err
+			}
+		default:
+			if err := write(t); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if 0 < len(stack) {
+		return nil, fmt.Errorf("unexpected end of json. %w", io.ErrUnexpectedEOF)
+	}
+	return out.Bytes(), nil
+}
+
+/*
+yamlNode
+YAMLのノードを辿り、文字列のスカラー値を置換する.
+*/
+func (w *documentReplacer) yamlNode(node *yaml.Node, path string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			w.yamlNode(n, path)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			w.yamlNode(node.Content[i+1], documentPath(path, node.Content[i].Value))
+		}
+	case yaml.SequenceNode:
+		for i, n := range node.Content {
+			w.yamlNode(n, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case yaml.ScalarNode:
+		if "!!str" != node.ShortTag() {
+			return
+		}
+		v := w.text(node.Value, path)
+		if s, ok := v.(string); ok {
+			node.Value = s
+			return
+		}
+		var replaced yaml.Node
+		if err := replaced.Encode(v); err != nil {
+			w.errs = append(w.errs, fmt.Errorf("%s: %w", path, err))
+			return
+		}
+		replaced.HeadComment, replaced.LineComment, replaced.FootComment = node.HeadComment, node.LineComment, node.FootComment
+		*node = replaced
+	}
+}
+
+/*
+goValue
+Goの値を辿り、文字列の値を置換する.
+*/
+func (w *documentReplacer) goValue(rv reflect.Value, path string) {
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if !rv.IsNil() {
+			w.goValue(rv.Elem(), path)
+		}
+	case reflect.Interface:
+		if rv.IsNil() || !rv.CanSet() {
+			return
+		}
+		switch rv.Elem().Interface().(type) {
+		case string, map[string]any, []any:
+			replaced := w.value(rv.Elem().Interface(), path)
+			if replaced != nil && reflect.TypeOf(replaced).AssignableTo(rv.Type()) {
+				rv.Set(reflect.ValueOf(replaced))
+			}
+		default:
+			// インタフェースが保持する値は直接変更できないため、複製して置換する
+			e := reflect.New(rv.Elem().Type()).Elem()
+			e.Set(rv.Elem())
+			w.goValue(e, path)
+			rv.Set(e)
+		}
+	case reflect.String:
+		if rv.CanSet() {
+			// string型のフィールドには文字列として設定する
+			rv.SetString(formatVariableValue(w.text(rv.String(), path)))
+		}
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if f := rv.Type().Field(i); f.IsExported() {
+				w.goValue(rv.Field(i), documentPath(path, f.Name))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			w.goValue(rv.Index(i), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Map:
+		// Mapの値は直接変更できないため、置換後の値を設定し直す
+		iter := rv.MapRange()
+		for iter.Next() {
+			e := reflect.New(rv.Type().Elem()).Elem()
+			e.Set(iter.Value())
+			w.goValue(e, documentPath(path, fmt.Sprint(iter.Key().Interface())))
+			rv.SetMapIndex(iter.Key(), e)
+		}
+	}
+}
+
+/*
+documentPath
+エラーに付与する値の位置.
+*/
+func documentPath(path string, key string) string {
+	for _, c := range key {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || '_' == c) {
+			return path + "[" + strconv.Quote(key) + "]"
+		}
+	}
+	return path + "." + key
+}
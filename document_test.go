@@ -0,0 +1,105 @@
+package ettt
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/*
+TestReplaceDocument JSON・YAML・Goの値の変数置換
+*/
+func TestReplaceDocument(t *testing.T) {
+	var gc = GlobalContext{
+		profile:     Profile{Variables: []ProfileVariable{{Key: "name", Value: `Alice "A"`}}},
+		globalStore: NewStoreVariables(),
+	}
+	var sc = ScenarioContext{}
+	sc.Store().PutNumber("count", 3)
+	sc.Store().PutBool("active", true)
+	if err := sc.Store().PutJSON("tags", []byte(`["a","b"]`)); err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		data := []byte(`{"z":"${profile.name}","a":["${store.count}","n=${store.count}",1.50,null],"${key}":{"active":"${store.active}"}}`)
+		out, err := ReplaceJSON(gc, sc, data, false)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if string(out) != `{"z":"Alice \"A\"","a":["3","n=3",1.50,null],"${key}":{"active":"true"}}` {
+			t.Fatalf("failed test %s", out)
+		}
+		out, err = ReplaceJSON(gc, sc, data, true)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if string(out) != `{"z":"Alice \"A\"","a":[3,"n=3",1.50,null],"${key}":{"active":true}}` {
+			t.Fatalf("failed test %s", out)
+		}
+	})
+	t.Run("YAML", func(t *testing.T) {
+		data := []byte("# users\nname: ${profile.name} # inline\ncount: \"${store.count}\"\ntags: ${store.tags}\nfixed: 10\n")
+		out, err := ReplaceYAML(gc, sc, data, true)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		expected := "# users\nname: Alice \"A\" # inline\ncount: 3\ntags:\n  - a\n  - b\nfixed: 10\n"
+		if string(out) != expected {
+			t.Fatalf("failed test %s", out)
+		}
+	})
+	t.Run("構造化された値", func(t *testing.T) {
+		v, err := ReplaceValue(gc, sc, map[string]any{"list": []any{"${store.tags}", "${store.count}!"}, "n": 1.0}, true)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		expected := map[string]any{"list": []any{[]any{"a", "b"}, "3!"}, "n": 1.0}
+		if !reflect.DeepEqual(v, expected) {
+			t.Fatalf("failed test %#v", v)
+		}
+	})
+	t.Run("Goの値", func(t *testing.T) {
+		type user struct {
+			Name    string
+			Count   string
+			Labels  map[string]string
+			Extra   any
+			Aliases []string
+			private string
+		}
+		u := &user{
+			Name:    "${profile.name}",
+			Count:   "${store.count}",
+			Labels:  map[string]string{"active": "${store.active}"},
+			Extra:   map[string]any{"count": "${store.count}"},
+			Aliases: []string{"x-${store.count}"},
+			private: "${store.count}",
+		}
+		if err := ReplaceInto(gc, sc, u, true); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		expected := &user{
+			Name:    `Alice "A"`,
+			Count:   "3",
+			Labels:  map[string]string{"active": "true"},
+			Extra:   map[string]any{"count": 3.0},
+			Aliases: []string{"x-3"},
+			private: "${store.count}",
+		}
+		if !reflect.DeepEqual(u, expected) {
+			t.Fatalf("failed test %#v", u)
+		}
+	})
+	t.Run("未解決の変数は位置を含む全てのエラー", func(t *testing.T) {
+		_, err := ReplaceJSON(gc, sc, []byte(`{"a":{"b c":["${x}"]},"d":"${y}"}`), true)
+		var unresolved *UnresolvedVariablesError
+		if !errors.As(err, &unresolved) || !strings.Contains(err.Error(), `$.a["b c"][0]: `) || !strings.Contains(err.Error(), "$.d: ") {
+			t.Fatalf("failed test %#v", err)
+		}
+		if _, err := ReplaceJSON(gc, sc, []byte(`{"a":`), false); err == nil {
+			t.Fatal("failed test")
+		}
+	})
+}
@@ -1,70 +1,204 @@
 package ettt
 
 import (
+	"context"
+	"fmt"
 	"github.com/google/uuid"
 	"log"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 )
 
+/*
+Phaseのタイムアウト・キャンセル後に、Phaseの終了を待つ猶予期間.
+テストから短縮できるよう変数としている.
+*/
+var phaseCancelGracePeriod = 5 * time.Second
+
 /*
 Engine
 実行エンジン
 */
 type Engine struct {
 	GlobalContext
+	// 排他グループ毎のロック
+	exclusiveLocks map[string]*sync.Mutex
+	// データ駆動シナリオ毎のロック. 同じシナリオの値を共有する行を逐次実行する.
+	rowLocks map[*Scenario]*sync.Mutex
+	// 実行シナリオ毎に前提とする実行シナリオのインデックス
+	dependencies [][]int
+	// 実行イベントをReporterに通知するバス
+	events *eventBus
 }
 
 /*
 New
-実行エンジン生成
+実行エンジン生成.
+シナリオ名にはメタデータの表示名、指定がない場合はシナリオの型名を利用する.
 */
 func New(scenarios []Scenario,
 	extensions []ExtensionContext,
 	options Options) (Engine, error) {
+	namedScenarios := make([]NamedScenario, 0, len(scenarios))
+	for _, s := range scenarios {
+		name := scenarioMetadata(s).DisplayName
+		if "" == name {
+			name = reflect.Indirect(reflect.ValueOf(s)).Type().Name()
+		}
+		namedScenarios = append(namedScenarios, NamedScenario{
+			Name:     name,
+			Scenario: s,
+		})
+	}
+	return NewNamed(namedScenarios, extensions, options)
+}
+
+/*
+NewNamed
+名前付きシナリオリストから実行エンジン生成.
+シナリオ名には指定された名前を利用する.
+*/
+func NewNamed(scenarios []NamedScenario,
+	extensions []ExtensionContext,
+	options Options) (Engine, error) {
 
 	log.SetPrefix("[ettt] ")
 	log.SetFlags(log.Lmsgprefix | log.Ldate | log.Ltime | log.Lmicroseconds)
+	installMaskingHandler()
 
 	// Profileの解析＆変数保持
-	profile, err := ParseProfile(resolveProfile(options))
+	profile, err := LoadProfile(options)
+	if err != nil {
+		slog.Error("profile parse error occurred...", "error", err)
+		return Engine{}, err
+	}
+
+	// 実行するシナリオのタグ選択式
+	tagExpression, err := ParseTagExpression(options.TagExpression)
+	if err != nil {
+		slog.Error("tag expression parse error occurred...", "error", err)
+		return Engine{}, err
+	}
+
+	// 実行するシナリオ名の正規表現
+	nameFilter, err := ParseScenarioNameFilter(options.RunExpression, options.SkipExpression)
 	if err != nil {
-		slog.Error("profile parse error occurred...", err)
+		slog.Error("scenario name expression parse error occurred...", "error", err)
 		return Engine{}, err
 	}
 
-	// 拡張機能コンテキストのMap作成
-	extensionMap := make(map[string]ExtensionContext, len(extensions))
+	// 拡張機能コンテキストの登録
+	// キーが重複する場合は上書きせずにエラーとする
+	globalContext := GlobalContext{
+		options:         options,
+		profile:         profile,
+		globalStore:     NewStoreVariables(),
+		extensionErrors: &extensionErrors{},
+	}
 	for _, e := range extensions {
-		extensionMap[e.ExtensionKey()] = e
+		if err := globalContext.RegistrationExtensionContext(e.ExtensionKey(), e); err != nil {
+			return Engine{}, err
+		}
 	}
 
 	// 実行シナリオリストの作成
+	// データ駆動シナリオはデータ行毎に実行シナリオとする
+	// シナリオ名の正規表現・タグ選択式を満たさないシナリオ、データ行がないデータ駆動シナリオは実行対象外（ScenarioNotRun）としてリストに残す
+	// 前提シナリオが実行対象外の場合、後続のシナリオはエラーではなくScenarioSkippedとなる
 	var executeScenarios []ExecuteScenario
-	for _, s := range scenarios {
-		rv := reflect.ValueOf(s)
-		sc := ScenarioContext{
-			scenarioName: rv.Type().Name(),
+	executeIndexes := make(map[string][]int)
+	exclusiveLocks := make(map[string]*sync.Mutex)
+	rowLocks := make(map[*Scenario]*sync.Mutex)
+	for i := range scenarios {
+		s := scenarios[i].Scenario
+		metadata := scenarioMetadata(s)
+		var skipReason string
+		var status ScenarioResultStatus
+		switch {
+		case !nameFilter.Match(scenarios[i].Name):
+			skipReason = fmt.Sprintf("excluded by name expression. run : %s, skip : %s", options.RunExpression, options.SkipExpression)
+			status = ScenarioNotRun
+		case !tagExpression.Match(metadata.Tags):
+			skipReason = "excluded by tag expression : " + options.TagExpression
+			status = ScenarioNotRun
+		}
+		rows := []*DataRow{nil}
+		if d, ok := s.(DataScenario); ok {
+			data, err := LoadDataTable(d.DataFile())
+			if err != nil {
+				slog.Error("data table load error occurred...", "error", err, "name", scenarios[i].Name)
+				return Engine{}, err
+			}
+			switch {
+			case 0 != len(data):
+				rows = rows[:0]
+				for j := range data {
+					rows = append(rows, &data[j])
+				}
+			case ScenarioNotRun != status:
+				// データ行がない場合もシナリオが消えないよう、データ行なしの1件を残す
+				slog.Warn("data table has no rows.", "name", scenarios[i].Name, "path", d.DataFile())
+				skipReason = "data table has no rows : " + d.DataFile()
+				status = ScenarioNotRun
+			}
+		}
+		for _, row := range rows {
+			sc := ScenarioContext{
+				index:                len(executeScenarios),
+				scenarioName:         scenarios[i].Name,
+				metadata:             metadata,
+				dependsOn:            scenarioDependencies(s),
+				scenarioResultStatus: status,
+				skipReason:           skipReason,
+				store:                NewStoreVariables(),
+				data:                 row,
+			}
+			if row != nil {
+				sc.scenarioName = dataScenarioName(scenarios[i].Name, *row)
+			}
+			executeIndexes[scenarios[i].Name] = append(executeIndexes[scenarios[i].Name], sc.index)
+			executeScenarios = append(executeScenarios, ExecuteScenario{
+				Scenario:        &s,
+				ScenarioContext: &sc,
+			})
+		}
+		// データ駆動シナリオの行は同じシナリオの値を共有するため、並列実行を許可したシナリオ以外は逐次実行する
+		if 1 < len(rows) && !parallelRows(s) {
+			rowLocks[&s] = &sync.Mutex{}
+		}
+		if group := exclusiveGroup(s); "" != group {
+			if _, ok := exclusiveLocks[group]; !ok {
+				exclusiveLocks[group] = &sync.Mutex{}
+			}
 		}
-		executeScenarios = append(executeScenarios, ExecuteScenario{
-			Scenario:        &s,
-			ScenarioContext: &sc,
-		})
 	}
 
-	// 全体コンテキストの作成
-	globalContext := GlobalContext{
-		options:    options,
-		extensions: extensionMap,
-		profile:    profile,
-		scenarios:  executeScenarios,
+	// 前提関係の解決
+	dependencies, err := resolveDependencies(executeScenarios, executeIndexes)
+	if err != nil {
+		slog.Error("scenario dependency error occurred...", "error", err)
+		return Engine{}, err
+	}
+
+	globalContext.scenarios = executeScenarios
+
+	// 実行イベントを購読するReporter
+	reporters := options.Reporters
+	if reporters == nil {
+		reporters = DefaultReporters()
 	}
 
 	return Engine{
-		globalContext,
+		GlobalContext:  globalContext,
+		exclusiveLocks: exclusiveLocks,
+		rowLocks:       rowLocks,
+		dependencies:   dependencies,
+		events:         &eventBus{reporters: reporters},
 	}, nil
 }
 
@@ -73,6 +207,16 @@ Run
 ツール実行
 */
 func (engine *Engine) Run() error {
+	return engine.RunContext(context.Background())
+}
+
+/*
+RunContext
+キャンセル可能なコンテキストを指定してツール実行.
+コンテキストは各Phaseのコンテキストの親となる.
+実行の進行に応じてイベントを発行し、OptionsのReportersに通知する.
+*/
+func (engine *Engine) RunContext(ctx context.Context) error {
 	var err error
 	// 実行開始タイムスタンプの保持（for Report）
 	engine.start = time.Now()
@@ -88,24 +232,140 @@ func (engine *Engine) Run() error {
 		slog.Error("failure create result dir.")
 		return err
 	}
+	engine.executionResultDir = executionResultDir
 
-	// 指定されたシナリオを随時実行
-	// IDEA: 並列化対応するのであれば、このあたりから変更
-	for i, v := range engine.scenarios {
-		slog.Info("start scenario.", "index", i, "name", v.ScenarioContext.scenarioName)
-		v.executionResultDir = executionResultDir
-		engine.runScenario(v)
-		slog.Info("end scenario.",
-			"index", i,
-			"name", v.ScenarioContext.scenarioName,
-			"status", v.scenarioResultStatus)
+	// 拡張機能の初期化
+	// 初期化に失敗した場合はシナリオを実行しない
+	if err = engine.initExtensions(); err != nil {
+		slog.Error("failure init extension.", "error", err)
+		return err
+	}
+	// 拡張機能が追加する変数式の関数
+	// 関数名が重複する場合は初期化済みの拡張機能をCloseしてシナリオを実行しない
+	if engine.functions, err = engine.extensionFunctions(); err != nil {
+		slog.Error("failure load variable functions.", "error", err)
+		engine.closeExtensions(engine.extensionOrder)
+		return err
+	}
+	// シナリオへの拡張機能の注入
+	// 注入できない場合は初期化済みの拡張機能をCloseしてシナリオを実行しない
+	if err = engine.injectExtensions(); err != nil {
+		engine.closeExtensions(engine.extensionOrder)
+		return err
+	}
+	if err := engine.publish(Event{Type: EventRunStarted}); err != nil {
+		slog.Warn("failure publish event.", "event", EventRunStarted, "error", err)
+	}
+
+	// 指定されたシナリオを最大並列実行数のワーカーで実行
+	// 前提シナリオが完了したシナリオから順にワーカーへ払い出す
+	// 結果はシナリオリスト上の位置に保持されるため、順序は常に定義順となる
+	concurrency := engine.options.MaxConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slog.Info("start scenarios.", "count", len(engine.scenarios), "concurrency", concurrency)
+	queue := make(chan ExecuteScenario)
+	done := make(chan int, len(engine.scenarios))
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range queue {
+				engine.executeScenario(ctx, v, executionResultDir)
+				done <- v.index
+			}
+		}()
+	}
+	scheduler := newScenarioScheduler(engine.scenarios, engine.dependencies, engine.scenarioFinished)
+	for !scheduler.completed() {
+		i, ok := scheduler.next()
+		if !ok {
+			scheduler.complete(<-done)
+			continue
+		}
+		select {
+		case queue <- engine.scenarios[i]:
+			scheduler.pop()
+		case d := <-done:
+			scheduler.complete(d)
+		}
 	}
+	close(queue)
+	wg.Wait()
+
+	// 拡張機能の後片付け
+	engine.closeExtensions(engine.extensionOrder)
 
 	// 実行終了タイムスタンプの保持（for Report）
 	engine.end = time.Now()
+
+	// 全体レポートの出力
+	if err = engine.publish(Event{Type: EventRunFinished}); err != nil {
+		slog.Error("failure report.", "error", err)
+		return err
+	}
 	return nil
 }
 
+/*
+publish
+実行イベントをReporterに通知する.
+*/
+func (engine *Engine) publish(event Event) error {
+	return engine.events.publish(engine.GlobalContext, event)
+}
+
+/*
+scenarioFinished
+シナリオの終了イベントを発行する.
+Reporterのエラーはシナリオの結果に影響させず、ログ出力のみとする.
+*/
+func (engine *Engine) scenarioFinished(es ExecuteScenario) {
+	if err := engine.publish(Event{Type: EventScenarioFinished, Scenario: es.ScenarioContext}); err != nil {
+		es.Logger().Error("failure scenario report.", "error", err)
+	}
+}
+
+/*
+executeScenario
+ワーカーから呼び出されるシナリオ単位の実行.
+データ駆動シナリオの行はシナリオ毎のロック、排他グループが指定されている場合は同一グループのロックを
+この順に取得してから実行する.
+*/
+func (engine *Engine) executeScenario(ctx context.Context, es ExecuteScenario, executionResultDir string) {
+	if lock, ok := engine.rowLocks[es.Scenario]; ok {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+	if lock, ok := engine.exclusiveLocks[exclusiveGroup(*es.Scenario)]; ok {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+	slog.Info("start scenario.", "index", es.index, "name", es.scenarioName)
+	es.executionResultDir = executionResultDir
+	started := engine.runScenario(ctx, es)
+	engine.afterScenario(es.ScenarioContext, started)
+	engine.scenarioFinished(es)
+	slog.Info("end scenario.",
+		"index", es.index,
+		"name", es.scenarioName,
+		"status", es.scenarioResultStatus)
+}
+
+/*
+exclusiveGroup
+シナリオの排他グループ名を取得.
+ExclusiveScenarioを実装していない場合は空文字.
+*/
+func exclusiveGroup(s Scenario) string {
+	if e, ok := s.(ExclusiveScenario); ok {
+		return e.ExclusiveGroup()
+	}
+	return ""
+}
+
 /*
 createResultDir
 実行結果のルートディレクトリの作成
@@ -113,13 +373,16 @@ createResultDir
 func (engine *Engine) createResultRootDir() (string, error) {
 	// 絶対パスの作成
 	var dirPath = engine.options.ResultPath
-	if filepath.IsAbs(engine.options.ResultPath) {
-		path, err := filepath.Abs("./")
+	if "" == dirPath {
+		dirPath = DefaultResultPath
+	}
+	if !filepath.IsAbs(dirPath) {
+		path, err := filepath.Abs(dirPath)
 		if err != nil {
 			slog.Error("failure absolute file path.")
 			return "", err
 		}
-		dirPath = path + engine.options.ResultPath
+		dirPath = path
 	}
 
 	if f, err := os.Stat(dirPath); os.IsNotExist(err) || !f.IsDir() {
@@ -168,117 +431,293 @@ func (engine *Engine) createDir(parent string, target string) (string, error) {
 	return targetPath, nil
 }
 
+/*
+resultDirName
+シナリオ名を結果ディレクトリ名として利用できる文字列に変換.
+ファイル名に利用できない記号・制御文字は _ に置き換える.
+*/
+func resultDirName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
 /*
 RunScenario
 シナリオ単位の実行関数.
+BeforeScenarioが成功した拡張機能を返却する.
 */
-func (engine *Engine) runScenario(es ExecuteScenario) {
+func (engine *Engine) runScenario(ctx context.Context, es ExecuteScenario) []ScenarioHookExtension {
 
 	var err error
 	var scenario = *es.Scenario
 	es.id = uuid.New()
 	es.start = time.Now()
+	es.logger = slog.Default().With("scenario", es.scenarioName, "id", es.id.String())
+	defer func() {
+		es.durationSeconds = es.end.Sub(es.start).Seconds()
+	}()
+	es.publish = func(event Event) {
+		if EventCommandResult == event.Type {
+			engine.commandResult(event.Scenario, *event.CommandResult)
+		}
+		if err := engine.publish(event); err != nil {
+			es.logger.Warn("failure publish event.", "event", event.Type, "error", err)
+		}
+	}
+	es.publishEvent(Event{Type: EventScenarioStarted})
 
 	// シナリオの結果ディレクトリ作成
-	scenarioResultDir, err := engine.createDir(es.executionResultDir, es.scenarioName+"_"+es.id.String())
+	scenarioResultDir, err := engine.createDir(es.executionResultDir, resultDirName(es.scenarioName)+"_"+es.id.String())
 	if err != nil {
-		slog.Error("failure create result dir.")
+		es.logger.Error("failure create result dir.")
 		es.end = time.Now()
 		es.error = err
 		es.scenarioResultStatus = ScenarioFailure
-		return
+		return nil
 	}
 	es.scenarioResultDir = scenarioResultDir
 	detailsDir, err := engine.createDir(es.scenarioResultDir, "details")
 	if err != nil {
-		slog.Error("failure create details dir.")
+		es.logger.Error("failure create details dir.")
 		es.end = time.Now()
 		es.error = err
 		es.scenarioResultStatus = ScenarioFailure
-		return
+		return nil
 	}
 	es.detailsDir = detailsDir
 	evidencesDir, err := engine.createDir(es.scenarioResultDir, "evidences")
 	if err != nil {
-		slog.Error("failure create evidences dir.")
+		es.logger.Error("failure create evidences dir.")
 		es.end = time.Now()
 		es.error = err
 		es.scenarioResultStatus = ScenarioFailure
-		return
+		return nil
 	}
 	es.evidencesDir = evidencesDir
 
-	// Execute Scenario
-	slog.Info("start Setup.")
-	es.ScenarioContext.phase = ScenarioPhaseSetup
-	err = scenario.Setup(engine.GlobalContext, es.ScenarioContext)
+	// 拡張機能のシナリオ開始処理
+	// エラーの場合はシナリオを実行しない
+	started, err := engine.beforeScenario(es.ScenarioContext)
 	if err != nil {
-		slog.Info("error Setup.")
 		es.end = time.Now()
-		es.scenarioResultStatus = ScenarioFailure
 		es.error = err
-		return
+		es.scenarioResultStatus = ScenarioFailure
+		return started
 	}
-	slog.Info("end Setup.")
 
-	slog.Info("start Exercise.")
-	es.ScenarioContext.phase = ScenarioPhaseExercise
-	err = scenario.Exercise(engine.GlobalContext, es.ScenarioContext)
-	if err != nil {
-		slog.Warn("error Exercise.")
-		es.end = time.Now()
+	// Execute Scenario
+	// リトライポリシーに従ってシナリオ全体を再実行する
+	// 前回までの試行のコマンド実行結果はリトライ済みとして保持する
+	policy := scenarioRetryPolicy(engine.GlobalContext, scenario)
+	for es.attempt = 1; ; es.attempt++ {
+		start := time.Now()
+		engine.runAttempt(ctx, es, scenario)
+		retry := policy.shouldRetry(es.attempt, scenarioCommandStatus(es.scenarioResultStatus), es.error) && nil == ctx.Err()
+		if retry {
+			es.logger.Warn("retry scenario.", "status", es.scenarioResultStatus, "attempt", es.attempt, "delay", policy.delay(es.attempt))
+			retry = nil == policy.wait(ctx, es.attempt)
+		}
+		if !retry {
+			break
+		}
+		es.attempts = append(es.attempts, ScenarioAttemptResult{
+			Attempt: es.attempt,
+			Status:  es.scenarioResultStatus,
+			Err:     es.error,
+			Start:   start,
+			End:     es.end,
+		})
+		es.resetAttempt()
+	}
+	es.flaky = ScenarioSuccess == es.scenarioResultStatus && (1 < es.attempt || es.hasRetriedResult())
+	return started
+}
+
+/*
+runAttempt
+シナリオを1回実行し、シナリオ実行結果ステータスを判定する.
+Setup開始後は、途中のPhaseでエラーが発生してもTearDownとクリーンアップを必ず実行する.
+*/
+func (engine *Engine) runAttempt(ctx context.Context, es ExecuteScenario, scenario Scenario) {
+	for _, phase := range []ScenarioPhase{ScenarioPhaseSetup, ScenarioPhaseExercise, ScenarioPhaseVerify} {
+		if err := engine.runPhase(ctx, es, phase, scenarioPhaseFunc(scenario, phase)); err != nil {
+			break
+		}
+	}
+	// 実行全体がキャンセルされた場合でも後片付けは行うため、キャンセルを引き継がない
+	tearDownCtx := context.WithoutCancel(ctx)
+	engine.runPhase(tearDownCtx, es, ScenarioPhaseTearDown, scenarioPhaseFunc(scenario, ScenarioPhaseTearDown))
+	es.ctx = tearDownCtx
+	es.runCleanups()
+
+	es.end = time.Now()
+	if 0 != len(es.phaseErrors) {
 		es.scenarioResultStatus = ScenarioFailure
-		es.error = err
+		es.error = es.joinPhaseErrors()
 		return
 	}
-	slog.Info("end Exercise.")
+	es.scenarioResultStatus = JudgeScenarioResult(*es.ScenarioContext)
+}
+
+/*
+runPhase
+Phase単位の実行.
+Phase毎のタイムアウトを設定したコンテキストで実行し、panicはエラーに変換する.
+タイムアウトまたはキャンセル時は、猶予期間を超えるとPhaseの終了を待たずにエラーとして扱う.
+その場合、Phaseの実行結果（コマンド実行結果・クリーンアップ・Store変数）は破棄し、以降のイベントも発行しない.
+エラーが発生した場合はPhaseErrorとしてシナリオコンテキストに保持する.
+*/
+func (engine *Engine) runPhase(ctx context.Context,
+	es ExecuteScenario,
+	phase ScenarioPhase,
+	fn func(gc GlobalContext, sc *ScenarioContext) error) error {
+	es.logger.Info("start phase.", "phase", phase)
 
-	slog.Info("start Verify.")
-	es.ScenarioContext.phase = ScenarioPhaseVerify
-	err = scenario.Verify(engine.GlobalContext, es.ScenarioContext)
+	var cancel context.CancelFunc
+	if timeout := engine.phaseTimeout(*es.Scenario, phase); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	es.ScenarioContext.ctx = ctx
+	es.ScenarioContext.phase = phase
+	es.publishEvent(Event{Type: EventPhaseChanged})
+	started, err := engine.beforePhase(es.ScenarioContext, phase)
+	defer engine.afterPhase(es.ScenarioContext, phase, started)
 	if err != nil {
-		slog.Warn("error Verify.")
-		es.end = time.Now()
-		es.scenarioResultStatus = ScenarioFailure
-		es.error = err
-		return
+		es.logger.Warn("error phase.", "phase", phase, "error", err)
+		return es.addPhaseError(phase, err)
 	}
-	slog.Info("end Verify.")
 
-	slog.Info("start TearDown.")
-	es.ScenarioContext.phase = ScenarioPhaseTearDown
-	err = scenario.TearDown(engine.GlobalContext, es.ScenarioContext)
+	// Phaseはシナリオコンテキストの複製で実行し、終了を確認できた場合のみ結果を反映する
+	// 猶予期間を超えても終了しないPhaseは複製のみを更新するため、後続処理と競合しない
+	fork := es.forkPhase()
+	gate := &phaseGate{}
+	if publish := es.publish; publish != nil {
+		fork.publish = func(event Event) {
+			gate.mu.Lock()
+			defer gate.mu.Unlock()
+			if !gate.closed {
+				publish(event)
+			}
+		}
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- callPhase(fn, engine.GlobalContext, fork)
+	}()
+	select {
+	case err = <-done:
+		es.joinPhase(fork)
+	case <-ctx.Done():
+		// キャンセルに応じて終了するPhaseは猶予期間内に終了を待つ
+		// 猶予期間を超えた場合は、Phaseの終了を待たずに後続処理を行う
+		select {
+		case <-done:
+			es.joinPhase(fork)
+		case <-time.After(phaseCancelGracePeriod):
+			es.logger.Error("phase did not return after cancellation. results of the phase are discarded.", "phase", phase)
+			gate.close()
+		}
+		err = fmt.Errorf("phase interrupted. %w", ctx.Err())
+	}
 	if err != nil {
-		slog.Info("error TearDown.")
-		es.end = time.Now()
-		es.scenarioResultStatus = ScenarioFailure
-		es.error = err
-		return
+		es.logger.Warn("error phase.", "phase", phase, "error", err)
+		return es.addPhaseError(phase, err)
 	}
-	slog.Info("end TearDown.")
+	es.logger.Info("end phase.", "phase", phase)
+	return nil
+}
 
-	es.scenarioResultStatus = JudgeScenarioResult(*es.ScenarioContext)
-	es.end = time.Now()
-	es.durationSeconds = es.end.Sub(es.start).Seconds()
+/*
+phaseGate
+終了しないPhaseのゴルーチンからのイベント発行を、後続処理へ進む前に遮断する.
+*/
+type phaseGate struct {
+	mu     sync.Mutex
+	closed bool
+}
+
+func (g *phaseGate) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+}
+
+/*
+callPhase
+Phaseの関数を実行し、panicをPanicErrorに変換する.
+*/
+func callPhase(fn func(gc GlobalContext, sc *ScenarioContext) error,
+	gc GlobalContext,
+	sc *ScenarioContext) (err error) {
+	defer recoverPanic(&err)
+	return fn(gc, sc)
+}
+
+/*
+phaseTimeout
+Phaseのタイムアウトを解決する.
+シナリオがTimeoutScenarioを実装して0より大きい値を返す場合はそちらを優先する.
+*/
+func (engine *Engine) phaseTimeout(s Scenario, phase ScenarioPhase) time.Duration {
+	if t, ok := s.(TimeoutScenario); ok {
+		if timeout := t.PhaseTimeout(phase); timeout > 0 {
+			return timeout
+		}
+	}
+	return engine.options.PhaseTimeout
+}
+
+/*
+scenarioPhaseFunc
+Phaseに対応するシナリオの関数を取得.
+ContextScenarioを実装している場合は、Phaseのコンテキストを渡す関数を取得する.
+*/
+func scenarioPhaseFunc(scenario Scenario, phase ScenarioPhase) func(gc GlobalContext, sc *ScenarioContext) error {
+	if cs, ok := scenario.(ContextScenario); ok {
+		fn := map[ScenarioPhase]func(ctx context.Context, gc GlobalContext, sc *ScenarioContext) error{
+			ScenarioPhaseSetup:    cs.SetupContext,
+			ScenarioPhaseExercise: cs.ExerciseContext,
+			ScenarioPhaseVerify:   cs.VerifyContext,
+			ScenarioPhaseTearDown: cs.TearDownContext,
+		}[phase]
+		return func(gc GlobalContext, sc *ScenarioContext) error {
+			return fn(sc.Context(), gc, sc)
+		}
+	}
+	switch phase {
+	case ScenarioPhaseSetup:
+		return scenario.Setup
+	case ScenarioPhaseExercise:
+		return scenario.Exercise
+	case ScenarioPhaseVerify:
+		return scenario.Verify
+	default:
+		return scenario.TearDown
+	}
 }
 
 /*
 resolveProfile
-Profile設定ファイルのパスを解決する.
+Profile名からProfile設定ファイルのパスを解決する.
 オプションで指定がない場合は、デフォルトのProfile設定ファイルのパスを返却する.
 */
-func resolveProfile(options Options) string {
-	profile := ProfileDefault
+func resolveProfile(options Options, profile string) string {
 	profilePath := ProfilePathDefault
-	if "" != options.Profile {
-		slog.Debug("use designation　profile", "profile", profile)
-		profile = options.Profile
+	if "" == profile {
+		profile = ProfileDefault
 	}
 	if "" != options.ProfilePath {
 		slog.Debug("use designation　profilePath", "profilePath", profilePath)
 		profilePath = options.ProfilePath
 	}
-	var profileFullPath = profilePath + profile + ".yaml"
+	var profileFullPath = filepath.Join(profilePath, profile+".yaml")
 	slog.Info("resolved profilePath finally", "profilePath", profileFullPath)
 	return profileFullPath
 }
@@ -286,33 +725,29 @@ func resolveProfile(options Options) string {
 /*
 JudgeScenarioResult
 シナリオ実行結果から、シナリオの実行結果コードを判定する.
+コマンド異常終了が１件でも含まれている場合は、異常終了とする.
 アサーションエラーが１件でも含まれている場合は、アサーションエラーとする.
+リトライにより置き換えられたコマンド実行結果は判定に含めない.
 */
 func JudgeScenarioResult(sc ScenarioContext) ScenarioResultStatus {
-	for _, v := range sc.setUpPhaseResults {
-		if v.Result == CommandAssertionError {
-			slog.Info("execute scenario assertion error on Setup.")
-			return ScenarioAssertionError
+	status := ScenarioSuccess
+	for _, phase := range ScenarioPhases {
+		for _, v := range sc.PhaseResults(phase) {
+			if v.Retried {
+				continue
+			}
+			switch v.Result {
+			case CommandFailure:
+				slog.Info("execute scenario failure.", "phase", phase)
+				return ScenarioFailure
+			case CommandAssertionError:
+				slog.Info("execute scenario assertion error.", "phase", phase)
+				status = ScenarioAssertionError
+			}
 		}
 	}
-	for _, v := range sc.exercisePhaseResults {
-		if v.Result == CommandAssertionError {
-			slog.Info("execute scenario assertion error on Exercise.")
-			return ScenarioAssertionError
-		}
-	}
-	for _, v := range sc.verifyPhaseResults {
-		if v.Result == CommandAssertionError {
-			slog.Info("execute scenario assertion error on Verify.")
-			return ScenarioAssertionError
-		}
-	}
-	for _, v := range sc.tearDownPhaseResults {
-		if v.Result == CommandAssertionError {
-			slog.Info("execute scenario assertion error on TearDown.")
-			return ScenarioAssertionError
-		}
+	if status == ScenarioSuccess {
+		slog.Info("execute scenario successful.")
 	}
-	slog.Info("execute scenario successful.")
-	return ScenarioSuccess
+	return status
 }
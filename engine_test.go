@@ -0,0 +1,453 @@
+package ettt
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/*
+concurrencyProbe 同時実行数を計測する.
+*/
+type concurrencyProbe struct {
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+func (p *concurrencyProbe) enter() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running++
+	if p.running > p.max {
+		p.max = p.running
+	}
+}
+
+func (p *concurrencyProbe) leave() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running--
+}
+
+/*
+sleepScenario Exercise中に一定時間待機するテスト用シナリオ.
+*/
+type sleepScenario struct {
+	probe    *concurrencyProbe
+	group    string
+	executed *int32
+}
+
+func (s sleepScenario) Setup(gc GlobalContext, sc *ScenarioContext) error {
+	return nil
+}
+
+func (s sleepScenario) Exercise(gc GlobalContext, sc *ScenarioContext) error {
+	s.probe.enter()
+	defer s.probe.leave()
+	atomic.AddInt32(s.executed, 1)
+	time.Sleep(20 * time.Millisecond)
+	return nil
+}
+
+func (s sleepScenario) Verify(gc GlobalContext, sc *ScenarioContext) error {
+	return nil
+}
+
+func (s sleepScenario) TearDown(gc GlobalContext, sc *ScenarioContext) error {
+	return nil
+}
+
+func (s sleepScenario) ExclusiveGroup() string {
+	return s.group
+}
+
+/*
+testOptions テスト用のProfileと結果ディレクトリを一時ディレクトリに作成したオプション.
+*/
+func testOptions(t *testing.T) Options {
+	t.Helper()
+	dir := t.TempDir()
+	profile := "name: test\nvariables:\n  - key: key1\n    value: value1\n"
+	if err := os.WriteFile(filepath.Join(dir, "test.yaml"), []byte(profile), 0o644); err != nil {
+		t.Fatalf("failed write profile %#v", err)
+	}
+	return Options{
+		Profile:     "test",
+		ProfilePath: dir + string(os.PathSeparator),
+		ResultPath:  filepath.Join(dir, "results"),
+	}
+}
+
+/*
+TestRunConcurrency Engine.Runの並列実行
+*/
+func TestRunConcurrency(t *testing.T) {
+	t.Run("最大並列実行数を超えない", func(t *testing.T) {
+		probe := &concurrencyProbe{}
+		var executed int32
+		var scenarios []Scenario
+		for i := 0; i < 8; i++ {
+			scenarios = append(scenarios, sleepScenario{probe: probe, executed: &executed})
+		}
+		options := testOptions(t)
+		options.MaxConcurrency = 3
+		engine, err := New(scenarios, nil, options)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if executed != 8 {
+			t.Fatalf("failed test executed=%d", executed)
+		}
+		if probe.max > 3 || probe.max < 2 {
+			t.Fatalf("failed test max concurrency=%d", probe.max)
+		}
+		for i, v := range engine.scenarios {
+			if v.index != i || v.scenarioResultStatus != ScenarioSuccess {
+				t.Fatalf("failed test index=%d status=%s", v.index, v.scenarioResultStatus)
+			}
+		}
+	})
+	t.Run("同一排他グループは同時に実行しない", func(t *testing.T) {
+		probe := &concurrencyProbe{}
+		var executed int32
+		var scenarios []Scenario
+		for i := 0; i < 4; i++ {
+			scenarios = append(scenarios, sleepScenario{probe: probe, group: "db", executed: &executed})
+		}
+		options := testOptions(t)
+		options.MaxConcurrency = 4
+		engine, err := New(scenarios, nil, options)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if executed != 4 || probe.max != 1 {
+			t.Fatalf("failed test executed=%d max concurrency=%d", executed, probe.max)
+		}
+	})
+}
+
+/*
+failingScenario 指定したPhaseでエラーを返却するテスト用シナリオ.
+*/
+type failingScenario struct {
+	failOn ScenarioPhase
+	calls  *[]string
+}
+
+func (s failingScenario) call(phase ScenarioPhase, sc *ScenarioContext) error {
+	*s.calls = append(*s.calls, string(phase))
+	if phase == ScenarioPhaseSetup {
+		sc.Cleanup("first", func() error {
+			*s.calls = append(*s.calls, "cleanup first")
+			return errors.New("cleanup failed")
+		})
+		sc.Cleanup("second", func() error {
+			*s.calls = append(*s.calls, "cleanup second")
+			return nil
+		})
+	}
+	if phase == s.failOn {
+		return errors.New("failed " + string(phase))
+	}
+	return nil
+}
+
+func (s failingScenario) Setup(gc GlobalContext, sc *ScenarioContext) error {
+	return s.call(ScenarioPhaseSetup, sc)
+}
+
+func (s failingScenario) Exercise(gc GlobalContext, sc *ScenarioContext) error {
+	return s.call(ScenarioPhaseExercise, sc)
+}
+
+func (s failingScenario) Verify(gc GlobalContext, sc *ScenarioContext) error {
+	return s.call(ScenarioPhaseVerify, sc)
+}
+
+func (s failingScenario) TearDown(gc GlobalContext, sc *ScenarioContext) error {
+	return s.call(ScenarioPhaseTearDown, sc)
+}
+
+/*
+TestRunTearDown Phaseエラー時のTearDownとクリーンアップの実行
+*/
+func TestRunTearDown(t *testing.T) {
+	var calls []string
+	engine, err := New([]Scenario{failingScenario{failOn: ScenarioPhaseExercise, calls: &calls}}, nil, testOptions(t))
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	if err := engine.Run(); err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	expected := "SetUp,Exercise,TearDown,cleanup second,cleanup first"
+	if strings.Join(calls, ",") != expected {
+		t.Fatalf("failed test calls=%v", calls)
+	}
+	es := engine.Scenarios()[0]
+	if es.ResultStatus() != ScenarioFailure || len(es.PhaseErrors()) != 2 {
+		t.Fatalf("failed test status=%s errors=%v", es.ResultStatus(), es.PhaseErrors())
+	}
+	if es.PhaseErrors()[0].Phase != ScenarioPhaseExercise || es.PhaseErrors()[1].Phase != ScenarioPhaseTearDown {
+		t.Fatalf("failed test errors=%v", es.PhaseErrors())
+	}
+	if !strings.Contains(es.Err().Error(), "failed Exercise") || !strings.Contains(es.Err().Error(), "cleanup failed") {
+		t.Fatalf("failed test error=%v", es.Err())
+	}
+}
+
+/*
+TestRunScenarioNameWithSlash 区切り文字を含むシナリオ名の結果ディレクトリ
+*/
+func TestRunScenarioNameWithSlash(t *testing.T) {
+	engine, err := NewNamed([]NamedScenario{{Name: "cli/login", Scenario: funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+		return nil
+	}}}}, nil, testOptions(t))
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	if err := engine.Run(); err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	es := engine.Scenarios()[0]
+	if ScenarioSuccess != es.ResultStatus() {
+		t.Fatalf("failed test status=%s error=%v", es.ResultStatus(), es.Err())
+	}
+	if dir := es.ScenarioResultDir(); engine.ExecutionResultDir() != filepath.Dir(dir) || !strings.HasPrefix(filepath.Base(dir), "cli_login_") {
+		t.Fatalf("failed test %s", dir)
+	}
+	if "login[bob_2]" != resultDirName("login[bob/2]") || `a_b_c_d` != resultDirName(`a\b:c*d`) {
+		t.Fatalf("failed test %s", resultDirName("login[bob/2]"))
+	}
+}
+
+/*
+funcScenario Exerciseの処理を関数で指定するテスト用シナリオ.
+*/
+type funcScenario struct {
+	exercise func(gc GlobalContext, sc *ScenarioContext) error
+	timeout  time.Duration
+	tornDown *bool
+}
+
+func (s funcScenario) Setup(gc GlobalContext, sc *ScenarioContext) error {
+	return nil
+}
+
+func (s funcScenario) Exercise(gc GlobalContext, sc *ScenarioContext) error {
+	return s.exercise(gc, sc)
+}
+
+func (s funcScenario) Verify(gc GlobalContext, sc *ScenarioContext) error {
+	return nil
+}
+
+func (s funcScenario) TearDown(gc GlobalContext, sc *ScenarioContext) error {
+	if s.tornDown != nil {
+		*s.tornDown = true
+	}
+	return nil
+}
+
+func (s funcScenario) PhaseTimeout(phase ScenarioPhase) time.Duration {
+	return s.timeout
+}
+
+/*
+contextScenario Phaseのコンテキストを引数で受け取るテスト用シナリオ.
+*/
+type contextScenario struct {
+	funcScenario
+	phases *[]string
+}
+
+func (s contextScenario) record(ctx context.Context, sc *ScenarioContext, phase string) {
+	if ctx == sc.Context() {
+		*s.phases = append(*s.phases, phase)
+	}
+}
+
+func (s contextScenario) SetupContext(ctx context.Context, gc GlobalContext, sc *ScenarioContext) error {
+	s.record(ctx, sc, "SetUp")
+	sc.Store().PutString("session", "abc")
+	return nil
+}
+
+func (s contextScenario) ExerciseContext(ctx context.Context, gc GlobalContext, sc *ScenarioContext) error {
+	s.record(ctx, sc, "Exercise")
+	sc.Run(gc, contextCommand{phases: s.phases})
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s contextScenario) VerifyContext(ctx context.Context, gc GlobalContext, sc *ScenarioContext) error {
+	s.record(ctx, sc, "Verify")
+	return nil
+}
+
+func (s contextScenario) TearDownContext(ctx context.Context, gc GlobalContext, sc *ScenarioContext) error {
+	// Setupで保存したStore変数は後のPhaseから参照できる
+	if session, _ := sc.Store().GetString("session"); "abc" == session {
+		s.record(ctx, sc, "TearDown")
+	}
+	return nil
+}
+
+/*
+contextCommand コンテキストを引数で受け取るテスト用コマンド.
+*/
+type contextCommand struct {
+	phases *[]string
+}
+
+func (c contextCommand) GetId() uuid.UUID {
+	return uuid.Nil
+}
+
+func (c contextCommand) Execute(gc GlobalContext, sc *ScenarioContext) {
+	*c.phases = append(*c.phases, "Execute")
+}
+
+func (c contextCommand) ExecuteContext(ctx context.Context, gc GlobalContext, sc *ScenarioContext) {
+	if ctx == sc.Context() {
+		*c.phases = append(*c.phases, "ExecuteContext")
+	}
+}
+
+/*
+TestContextScenario コンテキストを引数で受け取るシナリオとコマンド
+*/
+func TestContextScenario(t *testing.T) {
+	var phases []string
+	scenario := contextScenario{funcScenario: funcScenario{timeout: 50 * time.Millisecond}, phases: &phases}
+	engine, err := New([]Scenario{scenario}, nil, testOptions(t))
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	if err := engine.Run(); err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	es := engine.Scenarios()[0]
+	if ScenarioFailure != es.ResultStatus() || !errors.Is(es.Err(), context.DeadlineExceeded) {
+		t.Fatalf("failed test status=%s error=%v", es.ResultStatus(), es.Err())
+	}
+	if "SetUp,Exercise,ExecuteContext,TearDown" != strings.Join(phases, ",") {
+		t.Fatalf("failed test %v", phases)
+	}
+}
+
+/*
+TestRunPanicAndTimeout Phase実行時のpanic捕捉とタイムアウト
+*/
+func TestRunPanicAndTimeout(t *testing.T) {
+	t.Run("panicはScenarioFailureとなりTearDownも実行される", func(t *testing.T) {
+		var tornDown bool
+		scenario := funcScenario{
+			exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+				panic("boom")
+			},
+			tornDown: &tornDown,
+		}
+		engine, err := New([]Scenario{scenario}, nil, testOptions(t))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		es := engine.Scenarios()[0]
+		var panicError *PanicError
+		if es.ResultStatus() != ScenarioFailure || !errors.As(es.Err(), &panicError) || !tornDown {
+			t.Fatalf("failed test status=%s error=%v", es.ResultStatus(), es.Err())
+		}
+		if panicError.Value != "boom" || !strings.Contains(string(panicError.Stack), "funcScenario") {
+			t.Fatalf("failed test %v", panicError)
+		}
+	})
+	t.Run("シナリオ指定のタイムアウトでコンテキストがキャンセルされる", func(t *testing.T) {
+		scenario := funcScenario{
+			exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+				<-sc.Context().Done()
+				return sc.Context().Err()
+			},
+			timeout: 10 * time.Millisecond,
+		}
+		options := testOptions(t)
+		options.PhaseTimeout = time.Hour
+		engine, err := New([]Scenario{scenario}, nil, options)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		es := engine.Scenarios()[0]
+		if es.ResultStatus() != ScenarioFailure || !errors.Is(es.Err(), context.DeadlineExceeded) {
+			t.Fatalf("failed test status=%s error=%v", es.ResultStatus(), es.Err())
+		}
+	})
+	t.Run("キャンセルに応じないPhaseは結果を破棄して後続処理を行う", func(t *testing.T) {
+		grace := phaseCancelGracePeriod
+		phaseCancelGracePeriod = 20 * time.Millisecond
+		t.Cleanup(func() {
+			phaseCancelGracePeriod = grace
+		})
+		stop := make(chan struct{})
+		exited := make(chan struct{})
+		var tornDown bool
+		scenario := funcScenario{
+			exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+				defer close(exited)
+				// コンテキストのキャンセルを無視してシナリオコンテキストを更新し続ける
+				for {
+					select {
+					case <-stop:
+						return nil
+					default:
+					}
+					sc.Run(gc, evidenceCommand{result: CommandSuccess})
+					sc.Store().PutString("abandoned", "true")
+					sc.Cleanup("abandoned", func() error { return nil })
+				}
+			},
+			timeout:  10 * time.Millisecond,
+			tornDown: &tornDown,
+		}
+		r := &eventRecorder{}
+		engine, err := New([]Scenario{scenario}, []ExtensionContext{hookExtension{key: "a", recorder: r}}, testOptions(t))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		runErr := engine.Run()
+		close(stop)
+		<-exited
+		if runErr != nil {
+			t.Fatalf("failed test %#v", runErr)
+		}
+		es := engine.Scenarios()[0]
+		if es.ResultStatus() != ScenarioFailure || !errors.Is(es.Err(), context.DeadlineExceeded) || !tornDown {
+			t.Fatalf("failed test status=%s error=%v", es.ResultStatus(), es.Err())
+		}
+		if _, ok := es.Store().Get("abandoned"); ok || 0 != len(es.PhaseResults(ScenarioPhaseExercise)) {
+			t.Fatalf("failed test results=%d", len(es.PhaseResults(ScenarioPhaseExercise)))
+		}
+		if 0 > r.position("a AfterScenario") {
+			t.Fatalf("failed test %v", r.events)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package ettt
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+/*
+EventType 実行イベントの種類.
+*/
+type EventType string
+
+const (
+	// EventRunStarted 実行開始. 拡張機能の初期化後、最初のシナリオの実行前に発行する.
+	EventRunStarted = EventType("RunStarted")
+	// EventScenarioStarted シナリオ開始.
+	EventScenarioStarted = EventType("ScenarioStarted")
+	// EventPhaseChanged Phaseの開始.
+	EventPhaseChanged = EventType("PhaseChanged")
+	// EventCommandResult コマンド実行結果の登録.
+	EventCommandResult = EventType("CommandResult")
+	// EventEvidenceSaved エビデンスの保存.
+	EventEvidenceSaved = EventType("EvidenceSaved")
+	// EventScenarioFinished シナリオ終了. 実行しなかったシナリオ（ScenarioNotRun・ScenarioSkipped）も発行する.
+	EventScenarioFinished = EventType("ScenarioFinished")
+	// EventRunFinished 実行終了. 拡張機能のClose後に発行する.
+	EventRunFinished = EventType("RunFinished")
+)
+
+/*
+Event
+実行中に発行されるイベント.
+種類に応じて必要な項目のみ設定する.
+*/
+type Event struct {
+	Type EventType
+	// 発生時間
+	Time time.Time
+	// シナリオのイベントの場合に対象のシナリオ
+	Scenario *ScenarioContext
+	// Phaseのイベント・コマンド実行結果・エビデンスの場合に対象のPhase
+	Phase ScenarioPhase
+	// EventCommandResultの場合に登録された実行結果（秘匿値はマスク済み）
+	CommandResult *CommandResult
+	// EventEvidenceSavedの場合に保存されたエビデンス
+	Evidence *Evidence
+}
+
+/*
+Reporter
+実行イベントを購読してレポートを出力するインタフェース.
+OptionsのReportersに指定する. 未指定の場合はDefaultReportersとなる.
+イベントは発行順に1件ずつ通知されるため、実装はスレッドセーフである必要はない.
+EventRunFinishedで返却したエラーは実行全体のエラーとし、それ以外のイベントのエラーはログ出力のみとする.
+
+通知は発行元のシナリオの処理中に同期的に行い、通知中は全てのシナリオのイベント発行が待機する.
+  - OnEventからイベントを発行する処理（SaveEvidence・RegistrationCommandResultなど）を呼び出してはならない. デッドロックとなる.
+  - 時間のかかる処理は全シナリオの進行を止めるため、必要な値を複製して別のgoroutineで行うこと.
+*/
+type Reporter interface {
+	OnEvent(gc GlobalContext, event Event) error
+}
+
+/*
+ReporterFunc
+関数をReporterとして扱う.
+*/
+type ReporterFunc func(gc GlobalContext, event Event) error
+
+func (f ReporterFunc) OnEvent(gc GlobalContext, event Event) error {
+	return f(gc, event)
+}
+
+/*
+eventBus
+実行イベントをReporterに通知する.
+並列実行されるシナリオからのイベントも、発行順に1件ずつ通知する.
+ReporterがScenarioContextを安全に参照できるよう、キューを介さず発行元のgoroutineで通知する.
+そのため通知中の再発行（Reporterからのイベント発行）には対応しない.
+*/
+type eventBus struct {
+	mu        sync.Mutex
+	reporters []Reporter
+}
+
+/*
+publish
+全てのReporterにイベントを通知する.
+Reporterのエラー・panicは他のReporterへの通知を妨げず、まとめて返却する.
+*/
+func (b *eventBus) publish(gc GlobalContext, event Event) error {
+	if b == nil {
+		return nil
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var errs []error
+	for _, r := range b.reporters {
+		if err := callReporter(r, gc, event); err != nil {
+			slog.Warn("error reporter.", "event", event.Type, "error", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+/*
+callReporter
+Reporterにイベントを通知し、panicをPanicErrorに変換する.
+*/
+func callReporter(r Reporter, gc GlobalContext, event Event) (err error) {
+	defer recoverPanic(&err)
+	return r.OnEvent(gc, event)
+}
+
+/*
+publishEvent
+シナリオのイベントを発行する.
+エンジンから実行されていない場合は何もしない.
+*/
+func (sc *ScenarioContext) publishEvent(event Event) {
+	if sc.publish == nil {
+		return
+	}
+	event.Scenario = sc
+	if "" == event.Phase {
+		event.Phase = sc.phase
+	}
+	sc.publish(event)
+}
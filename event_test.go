@@ -0,0 +1,115 @@
+package ettt
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+TestRunEvents 実行イベントの発行とReporter
+*/
+func TestRunEvents(t *testing.T) {
+	t.Run("実行の進行に応じてイベントを発行する", func(t *testing.T) {
+		r := &eventRecorder{}
+		scenario := dependentScenario{funcScenario: funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+			sc.Run(gc, evidenceCommand{result: CommandAssertionError})
+			return nil
+		}}}
+		options := testOptions(t)
+		options.Reporters = []Reporter{ReporterFunc(func(gc GlobalContext, event Event) error {
+			recordEvent(r, event)
+			return nil
+		})}
+		engine, err := NewNamed([]NamedScenario{
+			{Name: "login", Scenario: scenario},
+			{Name: "logout", Scenario: dependentScenario{funcScenario: scenario.funcScenario, dependsOn: []string{"login"}}},
+		}, nil, options)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		expected := []string{
+			"RunStarted",
+			"ScenarioStarted login",
+			"PhaseChanged login SetUp",
+			"PhaseChanged login Exercise",
+			"EvidenceSaved login Exercise response.json",
+			"CommandResult login Exercise CommandAssertionError",
+			"PhaseChanged login Verify",
+			"PhaseChanged login TearDown",
+			"ScenarioFinished login ScenarioAssertionError",
+			"ScenarioFinished logout ScenarioSkipped",
+			"RunFinished",
+		}
+		if strings.Join(expected, "\n") != strings.Join(r.events, "\n") {
+			t.Fatalf("failed test %v", r.events)
+		}
+		// 既定のReporterを置き換えた場合はレポートを出力しない
+		if _, err := os.Stat(filepath.Join(engine.ExecutionResultDir(), DefaultReportTemplateIndexPath)); !os.IsNotExist(err) {
+			t.Fatalf("failed test %#v", err)
+		}
+	})
+	t.Run("実行終了時のReporterのエラーは実行全体のエラー", func(t *testing.T) {
+		errUpload := errors.New("upload failed")
+		var console bytes.Buffer
+		options := testOptions(t)
+		options.Reporters = append(DefaultReporters()[:3], ConsoleReporter{Writer: &console}, ReporterFunc(func(gc GlobalContext, event Event) error {
+			switch event.Type {
+			case EventScenarioStarted:
+				panic("boom")
+			case EventRunFinished:
+				return errUpload
+			}
+			return nil
+		}))
+		engine, err := New([]Scenario{funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+			return nil
+		}}}, nil, options)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); !errors.Is(err, errUpload) {
+			t.Fatalf("failed test %#v", err)
+		}
+		// 他のReporterへの通知は継続する
+		if ScenarioSuccess != engine.Scenarios()[0].ResultStatus() {
+			t.Fatalf("failed test %s", engine.Scenarios()[0].ResultStatus())
+		}
+		for _, path := range []string{DefaultReportTemplateIndexPath, DefaultJUnitReportPath, DefaultManifestPath} {
+			if _, err := os.Stat(filepath.Join(engine.ExecutionResultDir(), path)); err != nil {
+				t.Fatalf("failed test %#v", err)
+			}
+		}
+		if !strings.Contains(console.String(), "ScenarioSuccess        funcScenario") || !strings.Contains(console.String(), "ScenarioSuccess 1 scenarios") {
+			t.Fatalf("failed test %s", console.String())
+		}
+	})
+}
+
+/*
+recordEvent
+イベントを種類・シナリオ名・Phase・詳細の順に記録する.
+*/
+func recordEvent(r *eventRecorder, event Event) {
+	parts := []string{string(event.Type)}
+	if event.Scenario != nil {
+		parts = append(parts, event.Scenario.ScenarioName())
+	}
+	switch event.Type {
+	case EventPhaseChanged:
+		parts = append(parts, string(event.Phase))
+	case EventEvidenceSaved:
+		parts = append(parts, string(event.Phase), event.Evidence.Name)
+	case EventCommandResult:
+		parts = append(parts, string(event.Phase), string(event.CommandResult.Result))
+	case EventScenarioFinished:
+		parts = append(parts, string(event.Scenario.ResultStatus()))
+	}
+	r.record(strings.Join(parts, " "))
+}
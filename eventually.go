@@ -0,0 +1,168 @@
+package ettt
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultEventuallyTimeout Eventuallyのタイムアウトの既定値
+	DefaultEventuallyTimeout = 30 * time.Second
+	// DefaultEventuallyInterval Eventuallyの試行間隔の既定値
+	DefaultEventuallyInterval = 500 * time.Millisecond
+)
+
+/*
+EventuallyOptions
+Eventuallyの待機条件.
+*/
+type EventuallyOptions struct {
+	// 条件を満たすまで待機する時間. 0以下の場合はDefaultEventuallyTimeoutとなる.
+	Timeout time.Duration
+	// 試行間隔. 0以下の場合はDefaultEventuallyIntervalとなる.
+	Interval time.Duration
+	// 試行間隔の戦略. 未指定の場合はBackoffConstantとなる.
+	Backoff BackoffStrategy
+	// 試行間隔の上限. 0以下の場合は上限なし.
+	MaxInterval time.Duration
+}
+
+/*
+Observation
+Eventuallyの試行毎の観測結果.
+*/
+type Observation struct {
+	Attempt int
+	Result  CommandResultStatus
+	Message string
+	Error   error
+	Start   time.Time
+	// 実行時間（秒）
+	DurationSeconds float64
+}
+
+/*
+Eventually
+コマンドがCommandSuccessとなるまで、タイムアウトまで繰り返し実行する.
+試行毎の観測結果をObservationsに保持した1件の実行結果を登録する.
+タイムアウトした場合は最後の試行の結果ステータスとなり、Errorはcontext.DeadlineExceededを含む.
+シナリオのPhaseがキャンセルされた場合はCommandFailureとなる.
+*/
+func (sc *ScenarioContext) Eventually(gc GlobalContext, command Command, options EventuallyOptions) CommandResult {
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultEventuallyTimeout
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultEventuallyInterval
+	}
+	policy := RetryPolicy{Delay: options.Interval, Backoff: options.Backoff, MaxDelay: options.MaxInterval}
+
+	// 試行中のコマンドがタイムアウトを検知できるよう、Phaseのコンテキストを差し替える
+	parent := sc.Context()
+	ctx, cancel := context.WithTimeout(parent, options.Timeout)
+	defer cancel()
+	sc.ctx = ctx
+	defer func() {
+		sc.ctx = parent
+	}()
+
+	var result CommandResult
+	var observations []Observation
+	var evidences []Evidence
+	for attempt := 1; ; attempt++ {
+		result = sc.runCommand(gc, command, attempt)
+		observations = append(observations, Observation{
+			Attempt:         attempt,
+			Result:          result.Result,
+			Message:         result.Message,
+			Error:           result.Error,
+			Start:           result.Start,
+			DurationSeconds: result.DurationSeconds,
+		})
+		evidences = append(evidences, result.Evidences...)
+		if CommandSuccess == result.Result {
+			break
+		}
+		sc.Logger().Info("eventually not satisfied.", "command", result.Name, "result", result.Result, "attempt", attempt)
+		if err := policy.wait(ctx, attempt); err != nil {
+			break
+		}
+	}
+
+	last := observations[len(observations)-1]
+	result.Start = observations[0].Start
+	result.End = time.Now()
+	result.DurationSeconds = result.End.Sub(result.Start).Seconds()
+	result.Observations = observations
+	result.Evidences = evidences
+	elapsed := result.End.Sub(result.Start).Round(time.Millisecond)
+	switch {
+	case CommandSuccess == result.Result:
+		result.Message = strings.TrimSpace(fmt.Sprintf("satisfied after %d attempts in %s. %s", last.Attempt, elapsed, last.Message))
+	case parent.Err() != nil:
+		result.Result = CommandFailure
+		result.Message = fmt.Sprintf("interrupted after %d attempts in %s. last observation : %s", last.Attempt, elapsed, observationText(last))
+		result.Error = fmt.Errorf("eventually interrupted. %w", parent.Err())
+	default:
+		result.Message = fmt.Sprintf("not satisfied within %s (%d attempts in %s). last observation : %s", options.Timeout, last.Attempt, elapsed, observationText(last))
+		result.Error = fmt.Errorf("eventually timed out. last observation : %s. %w", observationText(last), context.DeadlineExceeded)
+	}
+	sc.appendCommandResult(result)
+	sc.Logger().Info("end eventually.", "command", result.Name, "result", result.Result, "attempts", last.Attempt, "duration", elapsed)
+	return result
+}
+
+/*
+EventuallyFunc
+条件関数がnilを返却するまで、タイムアウトまで繰り返し実行する.
+条件関数が返却したエラーは満たされなかった観測結果（CommandAssertionError）として扱う.
+条件関数には試行中のコンテキストが渡される.
+*/
+func (sc *ScenarioContext) EventuallyFunc(gc GlobalContext, name string, options EventuallyOptions, condition func(ctx context.Context) error) CommandResult {
+	return sc.Eventually(gc, conditionCommand{name: name, condition: condition}, options)
+}
+
+/*
+conditionCommand
+条件関数をコマンドとして実行する.
+*/
+type conditionCommand struct {
+	name      string
+	condition func(ctx context.Context) error
+}
+
+func (c conditionCommand) GetId() uuid.UUID {
+	return uuid.Nil
+}
+
+func (c conditionCommand) CommandName() string {
+	return c.name
+}
+
+func (c conditionCommand) CommandParameters() map[string]string {
+	return nil
+}
+
+func (c conditionCommand) Execute(gc GlobalContext, sc *ScenarioContext) {
+	if err := c.condition(sc.Context()); err != nil {
+		sc.RegistrationCommandResult(CommandResult{Result: CommandAssertionError, Message: err.Error(), Error: err})
+	}
+}
+
+/*
+observationText
+観測結果のメッセージとエラーを1つの文字列にする.
+*/
+func observationText(o Observation) string {
+	text := string(o.Result)
+	if "" != o.Message {
+		text += " " + o.Message
+	}
+	if o.Error != nil && o.Error.Error() != o.Message {
+		text += ": " + o.Error.Error()
+	}
+	return text
+}
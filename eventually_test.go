@@ -0,0 +1,66 @@
+package ettt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+TestEventually 条件を満たすまでの繰り返し実行
+*/
+func TestEventually(t *testing.T) {
+	options := EventuallyOptions{Timeout: time.Second, Interval: time.Millisecond}
+	t.Run("コマンドが成功するまで繰り返す", func(t *testing.T) {
+		failures := 2
+		sc := &ScenarioContext{phase: ScenarioPhaseVerify}
+		r := sc.Eventually(GlobalContext{}, flakyCommand{failures: &failures, status: CommandAssertionError}, options)
+		if CommandSuccess != r.Result || 3 != len(r.Observations) || 1 != len(sc.verifyPhaseResults) {
+			t.Fatalf("failed test %#v", r)
+		}
+		if CommandAssertionError != r.Observations[0].Result || "503 Service Unavailable" != r.Observations[1].Message || !strings.HasPrefix(r.Message, "satisfied after 3 attempts") {
+			t.Fatalf("failed test %#v", r)
+		}
+		if r.DurationSeconds < r.Observations[2].DurationSeconds || r.Start != r.Observations[0].Start {
+			t.Fatalf("failed test %#v", r)
+		}
+	})
+	t.Run("タイムアウトした場合は最後の観測結果を含む", func(t *testing.T) {
+		sc := &ScenarioContext{phase: ScenarioPhaseVerify}
+		attempts := 0
+		r := sc.EventuallyFunc(GlobalContext{}, "job completed", EventuallyOptions{Timeout: 50 * time.Millisecond, Interval: 5 * time.Millisecond, Backoff: BackoffExponential},
+			func(ctx context.Context) error {
+				attempts++
+				return fmt.Errorf("job status is RUNNING (%d)", attempts)
+			})
+		if CommandAssertionError != r.Result || !errors.Is(r.Error, context.DeadlineExceeded) || "job completed" != r.Name {
+			t.Fatalf("failed test %#v", r)
+		}
+		last := fmt.Sprintf("job status is RUNNING (%d)", attempts)
+		if len(r.Observations) != attempts || !strings.Contains(r.Message, last) || !strings.Contains(r.Error.Error(), last) {
+			t.Fatalf("failed test %s %v", r.Message, r.Error)
+		}
+		if JudgeScenarioResult(*sc) != ScenarioAssertionError {
+			t.Fatalf("failed test")
+		}
+	})
+	t.Run("シナリオのキャンセルに従う", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		sc := &ScenarioContext{phase: ScenarioPhaseVerify, ctx: ctx}
+		time.AfterFunc(20*time.Millisecond, cancel)
+		start := time.Now()
+		r := sc.EventuallyFunc(GlobalContext{}, "never", EventuallyOptions{Timeout: 10 * time.Second, Interval: time.Millisecond},
+			func(ctx context.Context) error {
+				return errors.New("not yet")
+			})
+		if CommandFailure != r.Result || !errors.Is(r.Error, context.Canceled) || time.Second < time.Since(start) {
+			t.Fatalf("failed test %#v", r)
+		}
+		if sc.Context() != ctx {
+			t.Fatalf("failed test")
+		}
+	})
+}
@@ -1,13 +1,61 @@
 package ettt
 
-import "github.com/google/uuid"
+import (
+	"errors"
+	"github.com/google/uuid"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
 
 /*
 Evidence
 証跡構造体
 */
 type Evidence struct {
-	Id   uuid.UUID
-	Name string
-	Path string
+	Id   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Path string    `json:"path"`
+}
+
+/*
+SaveEvidence
+エビデンス格納ディレクトリにエビデンスを保存し、実行中コマンドの結果に紐付ける.
+ファイル名は実行ID_名称となる.
+テキストの場合は秘匿値をマスクして保存する.
+保存後にEventEvidenceSavedを発行する.
+*/
+func (sc *ScenarioContext) SaveEvidence(name string, data []byte) (Evidence, error) {
+	if "" == sc.evidencesDir {
+		return Evidence{}, errors.New("evidences dir is not created")
+	}
+	evidence := Evidence{
+		Id:   uuid.New(),
+		Name: name,
+	}
+	evidence.Path = filepath.Join(sc.evidencesDir, evidence.Id.String()+"_"+filepath.Base(name))
+	if utf8.Valid(data) {
+		// テキストのエビデンスは秘匿値をマスクして保存する
+		data = []byte(Mask(string(data)))
+	}
+	if err := os.WriteFile(evidence.Path, data, 0o644); err != nil {
+		sc.Logger().Error("failure save evidence.", "error", err, "name", name)
+		return Evidence{}, err
+	}
+	sc.AddEvidence(evidence)
+	sc.publishEvent(Event{Type: EventEvidenceSaved, Evidence: &evidence})
+	return evidence, nil
+}
+
+/*
+AddEvidence
+保存済みのエビデンスを実行中コマンドの結果に紐付ける.
+Runによるコマンド実行中でない場合は紐付けを行わない.
+*/
+func (sc *ScenarioContext) AddEvidence(evidence Evidence) {
+	if sc.running == nil {
+		sc.Logger().Warn("evidence is not related to command.", "name", evidence.Name)
+		return
+	}
+	sc.running.Evidences = append(sc.running.Evidences, evidence)
 }
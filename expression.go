@@ -0,0 +1,367 @@
+package ettt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+variableExpression
+${...} の中身を解析した変数式.
+
+	変数パス                 profile.users[1].name
+	関数呼び出し             now("20060102"), uuid(), randInt(1, 100)
+	リテラル                 "abc", 'abc', 123, true
+	デフォルト値             store.x:-fallback （未定義または空文字の場合に利用）
+	フィルタ                 profile.name | upper | urlencode
+*/
+type variableExpression struct {
+	operand variableOperand
+	// デフォルト値の指定有無
+	hasFallback bool
+	// デフォルト値
+	fallback string
+	// フィルタ
+	filters []variableCall
+}
+
+/*
+variableOperand
+変数式の値. 変数パス・リテラル・関数呼び出しのいずれか.
+*/
+type variableOperand struct {
+	path string
+	// 解析済みの変数パス
+	segments  []variablePathSegment
+	literal   any
+	isLiteral bool
+	call      *variableCall
+}
+
+/*
+variableCall
+関数呼び出し.
+*/
+type variableCall struct {
+	name string
+	args []variableOperand
+}
+
+/*
+Evaluate 変数式を評価.
+変数パスの場合はLookupと同じ順序で解決する.
+*/
+func Evaluate(gc GlobalContext, sc ScenarioContext, expression string) (any, error) {
+	e, err := parseVariableExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	return e.evaluate(gc, sc)
+}
+
+func (e variableExpression) evaluate(gc GlobalContext, sc ScenarioContext) (any, error) {
+	v, err := e.operand.evaluate(gc, sc)
+	if e.hasFallback && (err != nil || "" == formatVariableValue(v)) {
+		v, err = e.fallback, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range e.filters {
+		if v, err = f.evaluate(gc, sc, v); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func (o variableOperand) evaluate(gc GlobalContext, sc ScenarioContext) (any, error) {
+	switch {
+	case o.isLiteral:
+		return o.literal, nil
+	case o.call != nil:
+		return o.call.evaluate(gc, sc)
+	}
+	return lookupVariable(gc, sc, o.path, o.segments)
+}
+
+/*
+evaluate
+関数を呼び出す. フィルタの場合はパイプで渡された値を先頭の引数とする.
+*/
+func (c variableCall) evaluate(gc GlobalContext, sc ScenarioContext, piped ...any) (any, error) {
+	fn, ok := gc.variableFunction(c.name)
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", c.name)
+	}
+	args := append(make([]any, 0, len(piped)+len(c.args)), piped...)
+	for _, a := range c.args {
+		v, err := a.evaluate(gc, sc)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	v, err := fn(args...)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeVariableValue(v), nil
+}
+
+/*
+expressionParser
+変数式の解析器.
+*/
+type expressionParser struct {
+	src string
+	pos int
+}
+
+/*
+parseVariableExpression
+変数式を解析.
+*/
+func parseVariableExpression(expression string) (variableExpression, error) {
+	p := &expressionParser{src: expression}
+	e, err := p.parseExpression()
+	if err != nil {
+		return variableExpression{}, fmt.Errorf("invalid expression. expression : %s. %w", expression, err)
+	}
+	return e, nil
+}
+
+func (p *expressionParser) parseExpression() (variableExpression, error) {
+	var e variableExpression
+	p.skipSpaces()
+	operand, err := p.parseOperand(false)
+	if err != nil {
+		return e, err
+	}
+	e.operand = operand
+
+	p.skipSpaces()
+	if strings.HasPrefix(p.rest(), ":-") {
+		p.pos += 2
+		p.skipSpaces()
+		if e.fallback, err = p.parseFallback(); err != nil {
+			return e, err
+		}
+		e.hasFallback = true
+	}
+
+	for p.skipSpaces(); !p.eof(); p.skipSpaces() {
+		if '|' != p.src[p.pos] {
+			return e, fmt.Errorf("unexpected character %q at %d", p.src[p.pos], p.pos)
+		}
+		p.pos++
+		p.skipSpaces()
+		name := p.parseIdent()
+		if "" == name {
+			return e, fmt.Errorf("filter name is required at %d", p.pos)
+		}
+		filter := variableCall{name: name}
+		p.skipSpaces()
+		if !p.eof() && '(' == p.src[p.pos] {
+			if filter.args, err = p.parseArgs(); err != nil {
+				return e, err
+			}
+		}
+		e.filters = append(e.filters, filter)
+	}
+	return e, nil
+}
+
+/*
+parseOperand
+変数パス・リテラル・関数呼び出しを解析.
+関数の引数の場合は true / false を真偽値のリテラルとして扱う.
+*/
+func (p *expressionParser) parseOperand(arg bool) (variableOperand, error) {
+	if p.eof() {
+		return variableOperand{}, fmt.Errorf("value is required at %d", p.pos)
+	}
+	c := p.src[p.pos]
+	switch {
+	case '"' == c || '\'' == c:
+		s, err := p.parseString()
+		return variableOperand{literal: s, isLiteral: true}, err
+	case isDigit(c) || ('-' == c && p.pos+1 < len(p.src) && isDigit(p.src[p.pos+1])):
+		return p.parseNumber()
+	}
+
+	start := p.pos
+	name := p.parseIdent()
+	if "" != name && !p.eof() && '(' == p.src[p.pos] {
+		args, err := p.parseArgs()
+		return variableOperand{call: &variableCall{name: name, args: args}}, err
+	}
+	p.pos = start
+	path := p.parsePath()
+	if "" == path {
+		return variableOperand{}, fmt.Errorf("unexpected character %q at %d", c, p.pos)
+	}
+	if arg && ("true" == path || "false" == path) {
+		return variableOperand{literal: "true" == path, isLiteral: true}, nil
+	}
+	segments, err := parseVariablePath(path)
+	if err != nil {
+		return variableOperand{}, err
+	}
+	return variableOperand{path: path, segments: segments}, nil
+}
+
+/*
+parseArgs
+関数の引数リスト（括弧を含む）を解析.
+*/
+func (p *expressionParser) parseArgs() ([]variableOperand, error) {
+	p.pos++ // (
+	var args []variableOperand
+	p.skipSpaces()
+	if !p.eof() && ')' == p.src[p.pos] {
+		p.pos++
+		return args, nil
+	}
+	for {
+		p.skipSpaces()
+		arg, err := p.parseOperand(true)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		p.skipSpaces()
+		if p.eof() {
+			return nil, fmt.Errorf("unclosed parenthesis at %d", p.pos)
+		}
+		switch p.src[p.pos] {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return args, nil
+		default:
+			return nil, fmt.Errorf("unexpected character %q at %d", p.src[p.pos], p.pos)
+		}
+	}
+}
+
+/*
+parseFallback
+デフォルト値を解析.
+文字列リテラル、またはフィルタ（|）までのテキスト.
+*/
+func (p *expressionParser) parseFallback() (string, error) {
+	if !p.eof() && ('"' == p.src[p.pos] || '\'' == p.src[p.pos]) {
+		return p.parseString()
+	}
+	end := strings.IndexByte(p.rest(), '|')
+	if end < 0 {
+		end = len(p.rest())
+	}
+	fallback := strings.TrimSpace(p.rest()[:end])
+	p.pos += end
+	return fallback, nil
+}
+
+/*
+parseString
+引用符で囲まれた文字列リテラルを解析.
+ダブルクォートの場合はGoの文字列リテラルと同じエスケープが利用できる.
+*/
+func (p *expressionParser) parseString() (string, error) {
+	quote := p.src[p.pos]
+	for i := p.pos + 1; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '\\':
+			if '"' == quote {
+				i++
+			}
+		case quote:
+			literal := p.src[p.pos : i+1]
+			p.pos = i + 1
+			if '\'' == quote {
+				return literal[1 : len(literal)-1], nil
+			}
+			s, err := strconv.Unquote(literal)
+			if err != nil {
+				return "", fmt.Errorf("invalid string literal %s", literal)
+			}
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unclosed string literal at %d", p.pos)
+}
+
+/*
+parseNumber
+数値リテラルを解析.
+*/
+func (p *expressionParser) parseNumber() (variableOperand, error) {
+	start := p.pos
+	p.pos++
+	for !p.eof() && (isDigit(p.src[p.pos]) || strings.IndexByte(".eE+-", p.src[p.pos]) >= 0) {
+		p.pos++
+	}
+	f, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+	if err != nil {
+		return variableOperand{}, fmt.Errorf("invalid number %s at %d", p.src[start:p.pos], start)
+	}
+	return variableOperand{literal: f, isLiteral: true}, nil
+}
+
+/*
+parseIdent
+関数名を解析.
+*/
+func (p *expressionParser) parseIdent() string {
+	start := p.pos
+	for !p.eof() && (isDigit(p.src[p.pos]) || '_' == p.src[p.pos] ||
+		('a' <= p.src[p.pos] && p.src[p.pos] <= 'z') || ('A' <= p.src[p.pos] && p.src[p.pos] <= 'Z')) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+/*
+parsePath
+変数パスを解析.
+空白・括弧・カンマ・パイプ・デフォルト値の区切り（:-）までを変数パスとする.
+*/
+func (p *expressionParser) parsePath() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.src[p.pos]
+		if strings.IndexByte(" \t\r\n(),|", c) >= 0 || strings.HasPrefix(p.rest(), ":-") {
+			break
+		}
+		if '[' == c {
+			// ['a b'] のように記号を含むキーを許容する
+			if end := strings.IndexByte(p.rest(), ']'); end >= 0 {
+				p.pos += end + 1
+				continue
+			}
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *expressionParser) skipSpaces() {
+	for !p.eof() && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *expressionParser) rest() string {
+	return p.src[p.pos:]
+}
+
+func (p *expressionParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,154 @@
+package ettt
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+functionExtension テスト用の関数を追加する拡張機能
+*/
+type functionExtension struct{}
+
+func (functionExtension) ExtensionKey() string {
+	return "function"
+}
+
+func (functionExtension) VariableFunctions() map[string]VariableFunction {
+	return map[string]VariableFunction{
+		"repeat": func(args ...any) (any, error) {
+			n, err := variableNumber(args[1])
+			if err != nil {
+				return nil, err
+			}
+			return strings.Repeat(formatVariableValue(args[0]), int(n)), nil
+		},
+		"upper": func(args ...any) (any, error) {
+			return fmt.Sprintf("<%s>", args[0]), nil
+		},
+	}
+}
+
+/*
+otherFunctionExtension functionExtensionと同名の関数を追加する拡張機能
+*/
+type otherFunctionExtension struct {
+	functionExtension
+}
+
+func (otherFunctionExtension) ExtensionKey() string {
+	return "other"
+}
+
+/*
+TestReplaceExpression 関数・デフォルト値・フィルタを含む変数式の置換
+*/
+func TestReplaceExpression(t *testing.T) {
+	var gc = GlobalContext{
+		profile: Profile{Variables: []ProfileVariable{
+			{Key: "name", Value: "Alice Smith"},
+			{Key: "empty", Value: ""},
+		}},
+		globalStore: NewStoreVariables(),
+	}
+	var sc = ScenarioContext{}
+	sc.Store().PutString("format", "2006")
+
+	t.Run("デフォルト値", func(t *testing.T) {
+		result, err := Replace(gc, sc, "${store.x:-fallback}/${profile.empty:- 'quoted | text' }/${profile.name:-unused}")
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if result != "fallback/quoted | text/Alice Smith" {
+			t.Fatalf("failed test %s", result)
+		}
+	})
+	t.Run("フィルタ", func(t *testing.T) {
+		result, err := Replace(gc, sc, "${profile.name | upper | urlencode}:${store.x:-a/b | urlencode}:${'abc' | base64 | base64decode}")
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if result != "ALICE+SMITH:a%2Fb:abc" {
+			t.Fatalf("failed test %s", result)
+		}
+	})
+	t.Run("関数呼び出し", func(t *testing.T) {
+		result, err := Replace(gc, sc, `${now("20060102")}|${now(store.format)}`)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		now := time.Now()
+		if result != now.Format("20060102")+"|"+now.Format("2006") {
+			t.Fatalf("failed test %s", result)
+		}
+		id, err := Replace(gc, sc, "${uuid()}")
+		if _, parseErr := uuid.Parse(id); err != nil || parseErr != nil {
+			t.Fatalf("failed test %s %#v", id, err)
+		}
+		for i := 0; i < 20; i++ {
+			s, err := Replace(gc, sc, "${randInt(1, 3)}")
+			if n, _ := strconv.Atoi(s); err != nil || n < 1 || 3 < n {
+				t.Fatalf("failed test %s %#v", s, err)
+			}
+		}
+		s, err := Replace(gc, sc, "${randString(12)}")
+		if err != nil || 12 != len(s) {
+			t.Fatalf("failed test %s %#v", s, err)
+		}
+		if s, err := Replace(gc, sc, "${randString(0)}"); err != nil || "" != s {
+			t.Fatalf("failed test %s %#v", s, err)
+		}
+		if s, err := Replace(gc, sc, "${randInt(-9007199254740992, 9007199254740992)}"); err != nil || "" == s {
+			t.Fatalf("failed test %s %#v", s, err)
+		}
+	})
+	t.Run("ランダム関数の範囲外の引数", func(t *testing.T) {
+		for _, target := range [][]any{{"randString", float64(-1)}, {"randString", float64(65537)}, {"randInt", -9e18, 9e18}, {"randInt", float64(0), 1e30}} {
+			if _, err := builtinFunctions[target[0].(string)](target[1:]...); err == nil || !strings.Contains(err.Error(), "out of range") {
+				t.Fatalf("failed test %v %#v", target, err)
+			}
+		}
+	})
+	t.Run("拡張機能による関数の追加と上書き", func(t *testing.T) {
+		gc := gc
+		if err := gc.RegistrationExtensionContext("function", functionExtension{}); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		functions, err := gc.extensionFunctions()
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		gc.functions = functions
+		result, err := Replace(gc, sc, "${repeat('ab', 3)}-${profile.name | upper}-${'x' | repeat(2) | lower}")
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if result != "ababab-<Alice Smith>-xx" {
+			t.Fatalf("failed test %s", result)
+		}
+	})
+	t.Run("複数の拡張機能の関数名の重複は実行開始時のエラー", func(t *testing.T) {
+		executed := false
+		engine, err := New([]Scenario{funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+			executed = true
+			return nil
+		}}}, []ExtensionContext{functionExtension{}, otherFunctionExtension{}}, testOptions(t))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err == nil || !strings.Contains(err.Error(), "duplicate variable function") || executed {
+			t.Fatalf("failed test %#v", err)
+		}
+	})
+	t.Run("不正な変数式", func(t *testing.T) {
+		for _, target := range []string{"${unknown()}", "${randInt(1)}", "${now(}", "${profile.name | }", "${'abc}", "${profile.name upper}"} {
+			if _, err := Replace(gc, sc, target); err == nil {
+				t.Fatalf("failed test %s", target)
+			}
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package ettt
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+/*
+InitExtension
+実行開始前に初期化（接続の確立など）を行う拡張機能が任意で実装するインタフェース.
+Initがエラーを返却した場合は、シナリオを実行せずに実行全体をエラーとする.
+*/
+type InitExtension interface {
+	ExtensionContext
+	Init(gc GlobalContext) error
+}
+
+/*
+CloseExtension
+実行終了時に後片付け（接続の切断など）を行う拡張機能が任意で実装するインタフェース.
+Initが成功した、またはInitを実装していない拡張機能に対して、登録と逆順に呼び出す.
+*/
+type CloseExtension interface {
+	ExtensionContext
+	Close(gc GlobalContext) error
+}
+
+/*
+ScenarioHookExtension
+シナリオの開始・終了時に処理を行う拡張機能が任意で実装するインタフェース.
+BeforeScenarioがエラーを返却した場合は、シナリオを実行せずにScenarioFailureとする.
+AfterScenarioはシナリオの結果が確定した後に、BeforeScenarioが成功した拡張機能のみ呼び出す.
+*/
+type ScenarioHookExtension interface {
+	ExtensionContext
+	BeforeScenario(gc GlobalContext, sc *ScenarioContext) error
+	AfterScenario(gc GlobalContext, sc *ScenarioContext) error
+}
+
+/*
+PhaseHookExtension
+Phaseの開始・終了時に処理を行う拡張機能が任意で実装するインタフェース.
+BeforePhaseがエラーを返却した場合は、Phaseを実行せずにPhaseErrorとする.
+AfterPhaseはPhaseがエラーとなった場合も、BeforePhaseが成功した拡張機能のみ呼び出す.
+*/
+type PhaseHookExtension interface {
+	ExtensionContext
+	BeforePhase(gc GlobalContext, sc *ScenarioContext, phase ScenarioPhase) error
+	AfterPhase(gc GlobalContext, sc *ScenarioContext, phase ScenarioPhase) error
+}
+
+/*
+CommandResultExtension
+コマンド実行結果の登録時に処理を行う拡張機能が任意で実装するインタフェース.
+秘匿値をマスクした後の実行結果が渡される.
+*/
+type CommandResultExtension interface {
+	ExtensionContext
+	OnCommandResult(gc GlobalContext, sc *ScenarioContext, result CommandResult) error
+}
+
+/*
+ExtensionError
+拡張機能のフックで発生したエラー.
+シナリオの結果に影響しないフック（AfterScenario・AfterPhase・OnCommandResult・Close）のエラーも、
+全体コンテキストに保持してレポートに出力する.
+*/
+type ExtensionError struct {
+	Key  string
+	Hook string
+	// シナリオのフックの場合はシナリオ名
+	Scenario string
+	Err      error
+}
+
+func (e *ExtensionError) Error() string {
+	if "" == e.Scenario {
+		return fmt.Sprintf("extension %s %s: %v", e.Key, e.Hook, e.Err)
+	}
+	return fmt.Sprintf("extension %s %s (%s): %v", e.Key, e.Hook, e.Scenario, e.Err)
+}
+
+func (e *ExtensionError) Unwrap() error {
+	return e.Err
+}
+
+/*
+extensionErrors
+並列実行されるシナリオから追加される拡張機能のエラー.
+*/
+type extensionErrors struct {
+	mu     sync.Mutex
+	errors []*ExtensionError
+}
+
+/*
+ExtensionErrors
+拡張機能のフックで発生したエラーを取得.
+*/
+func (gc GlobalContext) ExtensionErrors() []*ExtensionError {
+	if gc.extensionErrors == nil {
+		return nil
+	}
+	gc.extensionErrors.mu.Lock()
+	defer gc.extensionErrors.mu.Unlock()
+	return append([]*ExtensionError(nil), gc.extensionErrors.errors...)
+}
+
+/*
+callHook
+拡張機能のフックを呼び出す.
+panicはエラーに変換し、エラーは全体コンテキストに保持して返却する.
+*/
+func (gc GlobalContext) callHook(e ExtensionContext, hook string, sc *ScenarioContext, fn func() error) error {
+	var err error
+	func() {
+		defer recoverPanic(&err)
+		err = fn()
+	}()
+	if err == nil {
+		return nil
+	}
+	extensionError := &ExtensionError{Key: e.ExtensionKey(), Hook: hook, Err: maskError(err)}
+	logger := slog.Default()
+	if sc != nil {
+		extensionError.Scenario = sc.scenarioName
+		logger = sc.Logger()
+	}
+	logger.Warn("error extension hook.", "extension", extensionError.Key, "hook", hook, "error", err)
+	if gc.extensionErrors != nil {
+		gc.extensionErrors.mu.Lock()
+		gc.extensionErrors.errors = append(gc.extensionErrors.errors, extensionError)
+		gc.extensionErrors.mu.Unlock()
+	}
+	return extensionError
+}
+
+/*
+initExtensions
+拡張機能を登録順に初期化する.
+エラーが発生した場合は、初期化済みの拡張機能をCloseしてエラーを返却する.
+*/
+func (gc GlobalContext) initExtensions() error {
+	for i, e := range gc.extensionOrder {
+		if init, ok := e.(InitExtension); ok {
+			if err := gc.callHook(e, "Init", nil, func() error { return init.Init(gc) }); err != nil {
+				gc.closeExtensions(gc.extensionOrder[:i])
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/*
+closeExtensions
+拡張機能を登録と逆順にCloseする.
+エラーが発生しても残りの拡張機能のCloseは継続する.
+*/
+func (gc GlobalContext) closeExtensions(extensions []ExtensionContext) {
+	for i := len(extensions) - 1; i >= 0; i-- {
+		if c, ok := extensions[i].(CloseExtension); ok {
+			gc.callHook(c, "Close", nil, func() error { return c.Close(gc) })
+		}
+	}
+}
+
+/*
+beforeScenario
+BeforeScenarioを登録順に呼び出す. 最初のエラーで中断する.
+エラーの場合も、BeforeScenarioが成功した拡張機能を返却する.
+*/
+func (gc GlobalContext) beforeScenario(sc *ScenarioContext) ([]ScenarioHookExtension, error) {
+	var started []ScenarioHookExtension
+	for _, e := range gc.extensionOrder {
+		if h, ok := e.(ScenarioHookExtension); ok {
+			if err := gc.callHook(e, "BeforeScenario", sc, func() error { return h.BeforeScenario(gc, sc) }); err != nil {
+				return started, err
+			}
+			started = append(started, h)
+		}
+	}
+	return started, nil
+}
+
+/*
+afterScenario
+BeforeScenarioが成功した拡張機能のAfterScenarioを登録と逆順に呼び出す.
+*/
+func (gc GlobalContext) afterScenario(sc *ScenarioContext, started []ScenarioHookExtension) {
+	for i := len(started) - 1; i >= 0; i-- {
+		h := started[i]
+		gc.callHook(h, "AfterScenario", sc, func() error { return h.AfterScenario(gc, sc) })
+	}
+}
+
+/*
+beforePhase
+BeforePhaseを登録順に呼び出す. 最初のエラーで中断する.
+エラーの場合も、BeforePhaseが成功した拡張機能を返却する.
+*/
+func (gc GlobalContext) beforePhase(sc *ScenarioContext, phase ScenarioPhase) ([]PhaseHookExtension, error) {
+	var started []PhaseHookExtension
+	for _, e := range gc.extensionOrder {
+		if h, ok := e.(PhaseHookExtension); ok {
+			if err := gc.callHook(e, "BeforePhase", sc, func() error { return h.BeforePhase(gc, sc, phase) }); err != nil {
+				return started, err
+			}
+			started = append(started, h)
+		}
+	}
+	return started, nil
+}
+
+/*
+afterPhase
+BeforePhaseが成功した拡張機能のAfterPhaseを登録と逆順に呼び出す.
+*/
+func (gc GlobalContext) afterPhase(sc *ScenarioContext, phase ScenarioPhase, started []PhaseHookExtension) {
+	for i := len(started) - 1; i >= 0; i-- {
+		h := started[i]
+		gc.callHook(h, "AfterPhase", sc, func() error { return h.AfterPhase(gc, sc, phase) })
+	}
+}
+
+/*
+commandResult
+OnCommandResultを登録順に呼び出す.
+*/
+func (gc GlobalContext) commandResult(sc *ScenarioContext, result CommandResult) {
+	for _, e := range gc.extensionOrder {
+		if h, ok := e.(CommandResultExtension); ok {
+			gc.callHook(e, "OnCommandResult", sc, func() error { return h.OnCommandResult(gc, sc, result) })
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package ettt
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+hookExtension 全てのフックを実装し、呼び出しを記録するテスト用拡張機能.
+errorsにフック名を指定した場合はエラーを返却する.
+*/
+type hookExtension struct {
+	key      string
+	recorder *eventRecorder
+	errors   map[string]error
+}
+
+func (e hookExtension) ExtensionKey() string {
+	return e.key
+}
+
+func (e hookExtension) hook(name string) error {
+	e.recorder.record(e.key + " " + name)
+	return e.errors[name]
+}
+
+func (e hookExtension) Init(gc GlobalContext) error {
+	return e.hook("Init")
+}
+
+func (e hookExtension) Close(gc GlobalContext) error {
+	return e.hook("Close")
+}
+
+func (e hookExtension) BeforeScenario(gc GlobalContext, sc *ScenarioContext) error {
+	return e.hook("BeforeScenario")
+}
+
+func (e hookExtension) AfterScenario(gc GlobalContext, sc *ScenarioContext) error {
+	e.recorder.record(e.key + " status " + string(sc.ResultStatus()))
+	return e.hook("AfterScenario")
+}
+
+func (e hookExtension) BeforePhase(gc GlobalContext, sc *ScenarioContext, phase ScenarioPhase) error {
+	return e.hook("BeforePhase " + string(phase))
+}
+
+func (e hookExtension) AfterPhase(gc GlobalContext, sc *ScenarioContext, phase ScenarioPhase) error {
+	return e.hook("AfterPhase " + string(phase))
+}
+
+func (e hookExtension) OnCommandResult(gc GlobalContext, sc *ScenarioContext, result CommandResult) error {
+	return e.hook("OnCommandResult " + string(result.Result))
+}
+
+/*
+TestExtensionHooks 拡張機能のライフサイクルフック
+*/
+func TestExtensionHooks(t *testing.T) {
+	exercise := funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+		sc.Run(gc, evidenceCommand{result: CommandSuccess})
+		return nil
+	}}
+	t.Run("登録順に開始処理、逆順に終了処理を呼び出す", func(t *testing.T) {
+		r := &eventRecorder{}
+		engine, err := New([]Scenario{exercise}, []ExtensionContext{
+			hookExtension{key: "a", recorder: r},
+			hookExtension{key: "b", recorder: r},
+		}, testOptions(t))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		for _, order := range [][]string{
+			{"a Init", "b Init", "a BeforeScenario", "b BeforeScenario", "a BeforePhase SetUp", "b BeforePhase SetUp", "b AfterPhase SetUp", "a AfterPhase SetUp"},
+			{"a BeforePhase Exercise", "a OnCommandResult CommandSuccess", "b OnCommandResult CommandSuccess", "b AfterPhase Exercise"},
+			{"b AfterPhase TearDown", "a AfterPhase TearDown", "b status ScenarioSuccess", "b AfterScenario", "a AfterScenario", "b Close", "a Close"},
+		} {
+			for i := 1; i < len(order); i++ {
+				if p := r.position(order[i-1]); p < 0 || r.position(order[i]) <= p {
+					t.Fatalf("failed test %v", r.events)
+				}
+			}
+		}
+		if 0 != len(engine.ExtensionErrors()) {
+			t.Fatalf("failed test %v", engine.ExtensionErrors())
+		}
+	})
+	t.Run("Initのエラーはシナリオを実行せず、初期化済みの拡張機能をCloseする", func(t *testing.T) {
+		r := &eventRecorder{}
+		errInit := errors.New("connection refused")
+		engine, err := New([]Scenario{exercise}, []ExtensionContext{
+			hookExtension{key: "a", recorder: r},
+			hookExtension{key: "b", recorder: r, errors: map[string]error{"Init": errInit}},
+			hookExtension{key: "c", recorder: r},
+		}, testOptions(t))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		err = engine.Run()
+		var extensionError *ExtensionError
+		if !errors.Is(err, errInit) || !errors.As(err, &extensionError) || "b" != extensionError.Key || "Init" != extensionError.Hook {
+			t.Fatalf("failed test %#v", err)
+		}
+		if 0 <= r.position("a BeforeScenario") || 0 <= r.position("c Init") || 0 <= r.position("b Close") || 0 > r.position("a Close") {
+			t.Fatalf("failed test %v", r.events)
+		}
+	})
+	t.Run("BeforeScenarioのエラーはシナリオを実行せずにScenarioFailure", func(t *testing.T) {
+		r := &eventRecorder{}
+		executed := false
+		engine, err := New([]Scenario{funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+			executed = true
+			return nil
+		}}}, []ExtensionContext{
+			hookExtension{key: "a", recorder: r},
+			hookExtension{key: "b", recorder: r, errors: map[string]error{"BeforeScenario": errors.New("no session")}},
+			hookExtension{key: "c", recorder: r},
+		}, testOptions(t))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		es := engine.Scenarios()[0]
+		if executed || ScenarioFailure != es.ResultStatus() || !strings.Contains(es.Err().Error(), "no session") {
+			t.Fatalf("failed test executed=%t status=%s", executed, es.ResultStatus())
+		}
+		if 0 <= r.position("a BeforePhase SetUp") || 0 <= r.position("c BeforeScenario") {
+			t.Fatalf("failed test %v", r.events)
+		}
+		// BeforeScenarioが成功した拡張機能のみAfterScenarioを呼び出す
+		if 0 > r.position("a AfterScenario") || 0 <= r.position("b AfterScenario") || 0 <= r.position("c AfterScenario") {
+			t.Fatalf("failed test %v", r.events)
+		}
+	})
+	t.Run("BeforePhaseのエラーはPhaseError", func(t *testing.T) {
+		r := &eventRecorder{}
+		engine, err := New([]Scenario{exercise}, []ExtensionContext{
+			hookExtension{key: "a", recorder: r, errors: map[string]error{"BeforePhase Exercise": errors.New("not ready")}},
+			hookExtension{key: "b", recorder: r},
+		}, testOptions(t))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		es := engine.Scenarios()[0]
+		if ScenarioFailure != es.ResultStatus() || 1 != len(es.PhaseErrors()) || ScenarioPhaseExercise != es.PhaseErrors()[0].Phase {
+			t.Fatalf("failed test status=%s errors=%v", es.ResultStatus(), es.PhaseErrors())
+		}
+		if 0 != len(es.PhaseResults(ScenarioPhaseExercise)) || 0 > r.position("a BeforePhase TearDown") {
+			t.Fatalf("failed test %v", r.events)
+		}
+		// BeforePhaseが成功した拡張機能のみAfterPhaseを呼び出す
+		if 0 <= r.position("a AfterPhase Exercise") || 0 <= r.position("b BeforePhase Exercise") || 0 <= r.position("b AfterPhase Exercise") || 0 > r.position("a AfterPhase SetUp") {
+			t.Fatalf("failed test %v", r.events)
+		}
+	})
+	t.Run("終了処理のエラー・panicは結果に影響せずレポートに出力する", func(t *testing.T) {
+		r := &eventRecorder{}
+		engine, err := New([]Scenario{exercise}, []ExtensionContext{
+			hookExtension{key: "a", recorder: r, errors: map[string]error{
+				"AfterScenario":                  errors.New("upload failed"),
+				"OnCommandResult CommandSuccess": errors.New("stream closed"),
+				"Close":                          errors.New("disconnect failed"),
+			}},
+			panicExtension{},
+		}, testOptions(t))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if es := engine.Scenarios()[0]; ScenarioSuccess != es.ResultStatus() {
+			t.Fatalf("failed test %s", es.ResultStatus())
+		}
+		hooks := make(map[string]bool)
+		for _, e := range engine.ExtensionErrors() {
+			hooks[e.Key+" "+e.Hook] = true
+		}
+		if 4 != len(hooks) || !hooks["a AfterScenario"] || !hooks["a OnCommandResult"] || !hooks["a Close"] || !hooks["panic AfterPhase"] {
+			t.Fatalf("failed test %v", engine.ExtensionErrors())
+		}
+
+		bytes, err := os.ReadFile(filepath.Join(engine.ExecutionResultDir(), DefaultManifestPath))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		var manifest RunManifest
+		if err := json.Unmarshal(bytes, &manifest); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if len(engine.ExtensionErrors()) != len(manifest.ExtensionErrors) {
+			t.Fatalf("failed test %#v", manifest.ExtensionErrors)
+		}
+		index, err := os.ReadFile(filepath.Join(engine.ExecutionResultDir(), DefaultReportTemplateIndexPath))
+		if err != nil || !strings.Contains(string(index), "upload failed") {
+			t.Fatalf("failed test %#v", err)
+		}
+		junit, err := os.ReadFile(filepath.Join(engine.ExecutionResultDir(), DefaultJUnitReportPath))
+		if err != nil || !strings.Contains(string(junit), "<system-err>") {
+			t.Fatalf("failed test %#v", err)
+		}
+	})
+	t.Run("拡張機能のキーの重複はエラー", func(t *testing.T) {
+		r := &eventRecorder{}
+		if _, err := New([]Scenario{exercise}, []ExtensionContext{
+			hookExtension{key: "a", recorder: r},
+			hookExtension{key: "a", recorder: r},
+		}, testOptions(t)); err == nil {
+			t.Fatalf("failed test")
+		}
+		gc := GlobalContext{}
+		if err := gc.RegistrationExtensionContext("a", hookExtension{key: "a"}); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := gc.RegistrationExtensionContext("a", functionExtension{}); err == nil {
+			t.Fatalf("failed test")
+		}
+		if _, ok := gc.GetExtensionContext("a").(hookExtension); !ok {
+			t.Fatalf("failed test %#v", gc.GetExtensionContext("a"))
+		}
+	})
+}
+
+/*
+panicExtension AfterPhaseでpanicするテスト用拡張機能.
+*/
+type panicExtension struct{}
+
+func (panicExtension) ExtensionKey() string {
+	return "panic"
+}
+
+func (panicExtension) BeforePhase(gc GlobalContext, sc *ScenarioContext, phase ScenarioPhase) error {
+	return nil
+}
+
+func (panicExtension) AfterPhase(gc GlobalContext, sc *ScenarioContext, phase ScenarioPhase) error {
+	panic("boom")
+}
@@ -0,0 +1,215 @@
+package ettt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/google/uuid"
+	"math"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/*
+VariableFunction
+変数式で利用できる関数.
+フィルタ（${値 | 関数名(引数)}）として呼び出した場合は、パイプで渡された値が先頭の引数となる.
+引数・戻り値は string, float64, bool, map[string]any, []any のいずれか.
+*/
+type VariableFunction func(args ...any) (any, error)
+
+/*
+VariableFunctionExtension
+変数式で利用できる関数を追加する拡張機能が任意で実装するインタフェース.
+組み込み関数と同名の関数を返した場合は、拡張機能の関数が優先される.
+関数は拡張機能の初期化後に1度だけ取得する. 複数の拡張機能が同名の関数を返した場合は実行開始時のエラーとなる.
+*/
+type VariableFunctionExtension interface {
+	ExtensionContext
+	/*
+		VariableFunctions
+		関数名と関数の組.
+	*/
+	VariableFunctions() map[string]VariableFunction
+}
+
+const (
+	// randStringMaxLength randStringで生成できる文字列の最大長.
+	randStringMaxLength = 65536
+	// maxFunctionInt 関数の整数引数の絶対値の上限. float64で誤差なく表せる範囲とする.
+	maxFunctionInt = 1 << 53
+)
+
+/*
+組み込み関数.
+*/
+var builtinFunctions = map[string]VariableFunction{
+	// now([layout]) 現在日時. layoutはGoの日時フォーマット（省略時はRFC3339）
+	"now": func(args ...any) (any, error) {
+		layout := time.RFC3339
+		if 0 < len(args) {
+			layout = formatVariableValue(args[0])
+		}
+		return time.Now().Format(layout), nil
+	},
+	// uuid() ランダムなUUID
+	"uuid": func(args ...any) (any, error) {
+		return uuid.NewString(), nil
+	},
+	// randInt(min, max) min以上max以下のランダムな整数
+	"randInt": func(args ...any) (any, error) {
+		if err := functionArgs("randInt", args, 2); err != nil {
+			return nil, err
+		}
+		min, err := functionIntArg("randInt", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		max, err := functionIntArg("randInt", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if max < min {
+			return nil, fmt.Errorf("randInt: max %d is less than min %d", max, min)
+		}
+		// max-min+1 がint64の範囲を超えないようにbig.Intで計算する
+		span := new(big.Int).Sub(big.NewInt(max), big.NewInt(min))
+		n, err := rand.Int(rand.Reader, span.Add(span, big.NewInt(1)))
+		if err != nil {
+			return nil, err
+		}
+		return float64(n.Add(n, big.NewInt(min)).Int64()), nil
+	},
+	// randString(length) ランダムな英数字の文字列. lengthは0以上randStringMaxLength以下
+	"randString": func(args ...any) (any, error) {
+		if err := functionArgs("randString", args, 1); err != nil {
+			return nil, err
+		}
+		length, err := functionIntArg("randString", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 || randStringMaxLength < length {
+			return nil, fmt.Errorf("randString: length %d is out of range 0 to %d", length, randStringMaxLength)
+		}
+		const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+		b := make([]byte, length)
+		for i := range b {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
+			if err != nil {
+				return nil, err
+			}
+			b[i] = letters[n.Int64()]
+		}
+		return string(b), nil
+	},
+	// upper(s) 大文字に変換
+	"upper": stringFunction("upper", strings.ToUpper),
+	// lower(s) 小文字に変換
+	"lower": stringFunction("lower", strings.ToLower),
+	// trim(s) 前後の空白を除去
+	"trim": stringFunction("trim", strings.TrimSpace),
+	// urlencode(s) URLのクエリ文字列としてエンコード
+	"urlencode": stringFunction("urlencode", url.QueryEscape),
+	// urldecode(s) URLのクエリ文字列としてデコード
+	"urldecode": func(args ...any) (any, error) {
+		if err := functionArgs("urldecode", args, 1); err != nil {
+			return nil, err
+		}
+		return url.QueryUnescape(formatVariableValue(args[0]))
+	},
+	// base64(s) Base64でエンコード
+	"base64": stringFunction("base64", func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}),
+	// base64decode(s) Base64でデコード
+	"base64decode": func(args ...any) (any, error) {
+		if err := functionArgs("base64decode", args, 1); err != nil {
+			return nil, err
+		}
+		b, err := base64.StdEncoding.DecodeString(formatVariableValue(args[0]))
+		if err != nil {
+			return nil, fmt.Errorf("base64decode: %w", err)
+		}
+		return string(b), nil
+	},
+}
+
+/*
+variableFunction
+関数名に対応する関数を取得.
+拡張機能の関数、組み込み関数の順に検索する.
+*/
+func (gc GlobalContext) variableFunction(name string) (VariableFunction, bool) {
+	if fn, ok := gc.functions[name]; ok {
+		return fn, true
+	}
+	fn, ok := builtinFunctions[name]
+	return fn, ok
+}
+
+/*
+extensionFunctions
+拡張機能が追加する関数を登録順に取得し、関数名と関数の組を作成する.
+複数の拡張機能が同名の関数を返した場合はエラー.
+*/
+func (gc GlobalContext) extensionFunctions() (map[string]VariableFunction, error) {
+	functions := make(map[string]VariableFunction)
+	providers := make(map[string]string)
+	for _, e := range gc.extensionOrder {
+		provider, ok := e.(VariableFunctionExtension)
+		if !ok {
+			continue
+		}
+		for name, fn := range provider.VariableFunctions() {
+			if key, ok := providers[name]; ok {
+				return nil, fmt.Errorf("duplicate variable function %s. extensions : %s, %s", name, key, e.ExtensionKey())
+			}
+			providers[name] = e.ExtensionKey()
+			functions[name] = fn
+		}
+	}
+	return functions, nil
+}
+
+/*
+stringFunction
+文字列を1つ受け取り文字列を返す関数をVariableFunctionに変換.
+*/
+func stringFunction(name string, fn func(string) string) VariableFunction {
+	return func(args ...any) (any, error) {
+		if err := functionArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		return fn(formatVariableValue(args[0])), nil
+	}
+}
+
+/*
+functionArgs
+引数の数を検証.
+*/
+func functionArgs(name string, args []any, expected int) error {
+	if expected != len(args) {
+		return fmt.Errorf("%s: expected %d arguments. actual : %d", name, expected, len(args))
+	}
+	return nil
+}
+
+/*
+functionIntArg
+引数を整数として取得.
+絶対値がmaxFunctionIntを超える場合はエラー.
+*/
+func functionIntArg(name string, args []any, i int) (int64, error) {
+	f, err := variableNumber(args[i])
+	if err != nil || f != math.Trunc(f) {
+		return 0, fmt.Errorf("%s: argument %d is not integer. value : %s", name, i+1, formatVariableValue(args[i]))
+	}
+	if maxFunctionInt < math.Abs(f) {
+		return 0, fmt.Errorf("%s: argument %d is out of range. value : %s", name, i+1, formatVariableValue(args[i]))
+	}
+	return int64(f), nil
+}
@@ -0,0 +1,178 @@
+package ettt
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+)
+
+/*
+injectTag
+拡張機能を注入するシナリオのフィールドに指定するタグ.
+*/
+const injectTag = "inject"
+
+/*
+ExtensionNotFoundError
+指定された型・キーの拡張機能が登録されていない.
+*/
+type ExtensionNotFoundError struct {
+	// 拡張機能の型
+	Type string
+	// キーを指定して取得した場合のキー
+	Key string
+}
+
+func (e *ExtensionNotFoundError) Error() string {
+	if "" == e.Key {
+		return fmt.Sprintf("extension not found. type : %s", e.Type)
+	}
+	return fmt.Sprintf("extension not found. key : %s, type : %s", e.Key, e.Type)
+}
+
+/*
+Extension
+型を指定して拡張機能を取得する.
+型に一致する拡張機能が複数ある場合（インタフェース型の指定など）は、先に登録された拡張機能を返却する.
+登録されていない場合はExtensionNotFoundErrorを返却する.
+*/
+func Extension[T any](gc GlobalContext) (T, error) {
+	for _, e := range gc.extensionOrder {
+		if v, ok := e.(T); ok {
+			return v, nil
+		}
+	}
+	var zero T
+	return zero, &ExtensionNotFoundError{Type: typeName[T]()}
+}
+
+/*
+ExtensionByKey
+キーと型を指定して拡張機能を取得する.
+キーが登録されていない、または型が一致しない場合はExtensionNotFoundErrorを返却する.
+*/
+func ExtensionByKey[T any](gc GlobalContext, key string) (T, error) {
+	if v, ok := gc.extensions[key].(T); ok {
+		return v, nil
+	}
+	var zero T
+	return zero, &ExtensionNotFoundError{Type: typeName[T](), Key: key}
+}
+
+/*
+MustExtension
+型を指定して拡張機能を取得する.
+登録されていない場合はpanicする. Phase内のpanicはPhaseErrorとして扱われる.
+*/
+func MustExtension[T any](gc GlobalContext) T {
+	v, err := Extension[T](gc)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func typeName[T any]() string {
+	return reflect.TypeOf((*T)(nil)).Elem().String()
+}
+
+/*
+injectExtensions
+シナリオの公開フィールドのうち、タグ `ettt:"inject"` が指定されたフィールドに拡張機能を注入する.
+フィールドの型に代入可能な拡張機能のうち、先に登録された拡張機能を注入する.
+値が設定済みのフィールドは上書きしない.
+データ駆動シナリオの実行シナリオは同じシナリオを共有するため、シナリオ毎に1回だけ注入する.
+*/
+func (gc GlobalContext) injectExtensions() error {
+	injected := make(map[*Scenario]bool)
+	for _, es := range gc.scenarios {
+		if ScenarioNotRun == es.scenarioResultStatus || injected[es.Scenario] {
+			continue
+		}
+		injected[es.Scenario] = true
+		scenario, err := gc.injectScenario(*es.Scenario)
+		if err != nil {
+			slog.Error("failure inject extension.", "error", err, "name", es.scenarioName)
+			return fmt.Errorf("failure inject extension. scenario : %s. %w", es.scenarioName, err)
+		}
+		*es.Scenario = scenario
+	}
+	return nil
+}
+
+/*
+injectScenario
+シナリオのフィールドに拡張機能を注入する.
+ポインタのシナリオはそのまま、値のシナリオは注入したコピーを返却する.
+*/
+func (gc GlobalContext) injectScenario(scenario Scenario) (Scenario, error) {
+	rv := reflect.ValueOf(scenario)
+	target := rv
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return scenario, nil
+		}
+		target = rv.Elem()
+	}
+	if target.Kind() != reflect.Struct || !hasInjectField(target.Type()) {
+		return scenario, nil
+	}
+	if rv.Kind() != reflect.Pointer {
+		// 値のシナリオはフィールドを設定できないため、コピーに注入する
+		target = reflect.New(rv.Type()).Elem()
+		target.Set(rv)
+	}
+	for i := 0; i < target.NumField(); i++ {
+		f := target.Type().Field(i)
+		if !isInjectField(f) {
+			continue
+		}
+		if !f.IsExported() {
+			return nil, fmt.Errorf("can not inject unexported field. field : %s", f.Name)
+		}
+		if !target.Field(i).IsZero() {
+			continue
+		}
+		e, ok := gc.assignableExtension(f.Type)
+		if !ok {
+			return nil, fmt.Errorf("field : %s. %w", f.Name, &ExtensionNotFoundError{Type: f.Type.String()})
+		}
+		target.Field(i).Set(reflect.ValueOf(e))
+	}
+	if rv.Kind() == reflect.Pointer {
+		return scenario, nil
+	}
+	return target.Interface().(Scenario), nil
+}
+
+/*
+assignableExtension
+指定された型に代入可能な拡張機能のうち、先に登録された拡張機能を取得.
+*/
+func (gc GlobalContext) assignableExtension(t reflect.Type) (ExtensionContext, bool) {
+	for _, e := range gc.extensionOrder {
+		if reflect.TypeOf(e).AssignableTo(t) {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+func hasInjectField(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if isInjectField(t.Field(i)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isInjectField(f reflect.StructField) bool {
+	for _, option := range strings.Split(f.Tag.Get("ettt"), ",") {
+		if injectTag == strings.TrimSpace(option) {
+			return true
+		}
+	}
+	return false
+}
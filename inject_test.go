@@ -0,0 +1,134 @@
+package ettt
+
+import (
+	"errors"
+	"testing"
+)
+
+/*
+clientExtension 注入対象のテスト用拡張機能.
+*/
+type clientExtension struct {
+	baseUrl string
+}
+
+func (e *clientExtension) ExtensionKey() string {
+	return "client"
+}
+
+/*
+injectScenario 拡張機能を注入するテスト用シナリオ.
+*/
+type injectScenario struct {
+	funcScenario
+	Client    *clientExtension          `ettt:"inject"`
+	Functions VariableFunctionExtension `ettt:"inject"`
+	Other     *clientExtension
+}
+
+/*
+TestExtension 型を指定した拡張機能の取得
+*/
+func TestExtension(t *testing.T) {
+	client := &clientExtension{baseUrl: "http://localhost"}
+	gc := GlobalContext{}
+	for _, e := range []ExtensionContext{functionExtension{}, client} {
+		if err := gc.RegistrationExtensionContext(e.ExtensionKey(), e); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+	}
+	t.Run("型に一致する拡張機能を取得", func(t *testing.T) {
+		if v, err := Extension[*clientExtension](gc); err != nil || v != client {
+			t.Fatalf("failed test %#v", err)
+		}
+		if v, err := Extension[VariableFunctionExtension](gc); err != nil || "function" != v.ExtensionKey() {
+			t.Fatalf("failed test %#v", err)
+		}
+		if v, err := ExtensionByKey[*clientExtension](gc, "client"); err != nil || v != client {
+			t.Fatalf("failed test %#v", err)
+		}
+		if v := MustExtension[*clientExtension](gc); v != client {
+			t.Fatalf("failed test %#v", v)
+		}
+	})
+	t.Run("登録されていない場合はエラー", func(t *testing.T) {
+		var notFound *ExtensionNotFoundError
+		if _, err := Extension[*hookExtension](gc); !errors.As(err, &notFound) || "*ettt.hookExtension" != notFound.Type {
+			t.Fatalf("failed test %#v", err)
+		}
+		if _, err := ExtensionByKey[*clientExtension](gc, "function"); !errors.As(err, &notFound) || "function" != notFound.Key {
+			t.Fatalf("failed test %#v", err)
+		}
+		if _, err := ExtensionByKey[*clientExtension](gc, "unknown"); !errors.As(err, &notFound) {
+			t.Fatalf("failed test %#v", err)
+		}
+	})
+}
+
+/*
+TestInjectExtensions シナリオへの拡張機能の注入
+*/
+func TestInjectExtensions(t *testing.T) {
+	t.Run("タグを指定したフィールドに注入する", func(t *testing.T) {
+		client := &clientExtension{baseUrl: "http://localhost"}
+		var injected []injectScenario
+		noop := funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+			return nil
+		}}
+		pointer := &injectScenario{funcScenario: noop}
+		pointer.exercise = func(gc GlobalContext, sc *ScenarioContext) error {
+			injected = append(injected, *pointer)
+			return nil
+		}
+		engine, err := New([]Scenario{pointer, injectScenario{funcScenario: noop}}, []ExtensionContext{client, functionExtension{}}, testOptions(t))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if 1 != len(injected) || client != injected[0].Client || nil == injected[0].Functions || nil != injected[0].Other {
+			t.Fatalf("failed test %#v", injected)
+		}
+		// 値のシナリオは注入したコピーに置き換える
+		value, ok := (*engine.Scenarios()[1].Scenario).(injectScenario)
+		if !ok || client != value.Client || nil == value.Functions {
+			t.Fatalf("failed test %#v", value)
+		}
+	})
+	t.Run("設定済みのフィールドは上書きしない", func(t *testing.T) {
+		client := &clientExtension{baseUrl: "http://localhost"}
+		other := &clientExtension{baseUrl: "http://example.com"}
+		scenario := &injectScenario{funcScenario: funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+			return nil
+		}}, Client: other}
+		engine, err := New([]Scenario{scenario}, []ExtensionContext{client, functionExtension{}}, testOptions(t))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if other != scenario.Client {
+			t.Fatalf("failed test %#v", scenario.Client)
+		}
+	})
+	t.Run("注入する拡張機能がない場合はシナリオを実行しない", func(t *testing.T) {
+		r := &eventRecorder{}
+		executed := false
+		engine, err := New([]Scenario{&injectScenario{funcScenario: funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+			executed = true
+			return nil
+		}}}}, []ExtensionContext{hookExtension{key: "hook", recorder: r}, &clientExtension{}}, testOptions(t))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		var notFound *ExtensionNotFoundError
+		if err := engine.Run(); !errors.As(err, &notFound) || "ettt.VariableFunctionExtension" != notFound.Type {
+			t.Fatalf("failed test %#v", err)
+		}
+		if executed || 0 > r.position("hook Close") {
+			t.Fatalf("failed test executed=%t events=%v", executed, r.events)
+		}
+	})
+}
@@ -0,0 +1,275 @@
+package ettt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+JUnitTestSuites
+JUnit XMLのルート要素.
+*/
+type JUnitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []JUnitTestSuite `xml:"testsuite"`
+}
+
+/*
+JUnitTestSuite
+JUnit XMLのテストスイート.
+1回の実行を1テストスイートとして扱う.
+*/
+type JUnitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []JUnitTestCase `xml:"testcase"`
+	SystemErr string          `xml:"system-err,omitempty"`
+}
+
+/*
+JUnitTestCase
+JUnit XMLのテストケース.
+1シナリオを1テストケースとして扱う.
+*/
+type JUnitTestCase struct {
+	Name       string           `xml:"name,attr"`
+	ClassName  string           `xml:"classname,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties *JUnitProperties `xml:"properties,omitempty"`
+	Failure    *JUnitProblem    `xml:"failure,omitempty"`
+	Error      *JUnitProblem    `xml:"error,omitempty"`
+	Skipped    *JUnitSkipped    `xml:"skipped,omitempty"`
+	Flaky      []JUnitProblem   `xml:"flakyFailure,omitempty"`
+	SystemOut  string           `xml:"system-out,omitempty"`
+}
+
+/*
+JUnitProperties
+JUnit XMLのproperties要素.
+シナリオのメタデータを出力する.
+*/
+type JUnitProperties struct {
+	Properties []JUnitProperty `xml:"property"`
+}
+
+/*
+JUnitProperty
+JUnit XMLのproperty要素.
+*/
+type JUnitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+/*
+JUnitSkipped
+JUnit XMLのskipped要素.
+*/
+type JUnitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+/*
+JUnitProblem
+JUnit XMLのfailure/error要素.
+*/
+type JUnitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+/*
+JUnitReport
+実行毎の結果ディレクトリにJUnit XML（junit.xml）を出力する.
+ScenarioAssertionErrorはfailure、ScenarioFailureはerror、ScenarioNotRun・ScenarioSkippedはskippedとして出力する.
+リトライ後に成功したシナリオは、リトライした試行をflakyFailureとして出力する.
+拡張機能のフックで発生したエラーはテストスイートのsystem-errとして出力する.
+*/
+func JUnitReport(globalContext GlobalContext) error {
+	suites := NewJUnitTestSuites(globalContext)
+	bytes, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		slog.Error("failure marshal junit report.", "error", err)
+		return err
+	}
+	path := filepath.Join(globalContext.executionResultDir, DefaultJUnitReportPath)
+	if err := os.WriteFile(path, append([]byte(xml.Header), bytes...), 0o644); err != nil {
+		slog.Error("failure write junit report.", "error", err, "path", path)
+		return err
+	}
+	return nil
+}
+
+/*
+NewJUnitTestSuites
+全体コンテキストからJUnit XMLの構造体を作成.
+*/
+func NewJUnitTestSuites(globalContext GlobalContext) JUnitTestSuites {
+	suite := JUnitTestSuite{
+		Name:      "ettt",
+		Time:      junitSeconds(globalContext.end.Sub(globalContext.start).Seconds()),
+		Timestamp: globalContext.start.Format("2006-01-02T15:04:05"),
+	}
+	if "" != globalContext.profile.Name {
+		suite.Name = "ettt." + globalContext.profile.Name
+	}
+	for _, v := range globalContext.scenarios {
+		testCase := JUnitTestCase{
+			Name:       v.scenarioName,
+			ClassName:  suite.Name,
+			Time:       junitSeconds(v.durationSeconds),
+			Properties: junitProperties(v.metadata),
+			SystemOut:  junitSystemOut(v.ScenarioContext),
+		}
+		switch v.scenarioResultStatus {
+		case ScenarioAssertionError:
+			suite.Failures++
+			testCase.Failure = junitProblem(v.ScenarioContext, CommandAssertionError)
+		case ScenarioFailure:
+			suite.Errors++
+			testCase.Error = junitProblem(v.ScenarioContext, CommandFailure)
+		case ScenarioNotRun, ScenarioSkipped:
+			suite.Skipped++
+			testCase.Skipped = &JUnitSkipped{Message: v.skipReason}
+		}
+		if v.flaky {
+			testCase.Flaky = junitFlaky(v.ScenarioContext)
+		}
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	var extensionErrors []string
+	for _, e := range globalContext.ExtensionErrors() {
+		extensionErrors = append(extensionErrors, e.Error())
+	}
+	suite.SystemErr = strings.Join(extensionErrors, "\n")
+	return JUnitTestSuites{
+		Name:     suite.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []JUnitTestSuite{suite},
+	}
+}
+
+/*
+junitProblem
+failure/error要素を作成.
+メッセージはシナリオのエラーを優先し、なければ該当ステータスのコマンド結果を利用する.
+*/
+func junitProblem(sc *ScenarioContext, status CommandResultStatus) *JUnitProblem {
+	problem := &JUnitProblem{Type: string(sc.scenarioResultStatus)}
+	var lines []string
+	for _, phase := range ScenarioPhases {
+		for _, r := range sc.PhaseResults(phase) {
+			if r.Result != status || r.Retried {
+				continue
+			}
+			line := fmt.Sprintf("[%s] %s", phase, r.Message)
+			if r.Error != nil {
+				line += ": " + r.Error.Error()
+			}
+			lines = append(lines, line)
+		}
+	}
+	if sc.error != nil {
+		problem.Message = sc.error.Error()
+	} else if 0 != len(lines) {
+		problem.Message = lines[0]
+	}
+	problem.Body = strings.Join(lines, "\n")
+	return problem
+}
+
+/*
+junitFlaky
+リトライ後に成功したシナリオの、リトライした試行をflakyFailure要素に変換.
+*/
+func junitFlaky(sc *ScenarioContext) []JUnitProblem {
+	var problems []JUnitProblem
+	for _, v := range sc.attempts {
+		problem := JUnitProblem{Message: fmt.Sprintf("scenario attempt %d", v.Attempt), Type: string(v.Status)}
+		if v.Err != nil {
+			problem.Body = v.Err.Error()
+		}
+		problems = append(problems, problem)
+	}
+	for _, phase := range ScenarioPhases {
+		for _, r := range sc.PhaseResults(phase) {
+			if !r.Retried {
+				continue
+			}
+			problem := JUnitProblem{Message: fmt.Sprintf("[%s] %s attempt %d", phase, r.Name, r.Attempt), Type: string(r.Result), Body: r.Message}
+			if r.Error != nil {
+				problem.Body = strings.TrimSpace(problem.Body + "\n" + r.Error.Error())
+			}
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
+
+/*
+junitProperties
+シナリオのメタデータをproperty要素に変換.
+タグ・チケットIDは値毎にproperty要素とする. メタデータがない場合はnil.
+*/
+func junitProperties(metadata ScenarioMetadata) *JUnitProperties {
+	var properties []JUnitProperty
+	for _, p := range []JUnitProperty{
+		{Name: "displayName", Value: metadata.DisplayName},
+		{Name: "description", Value: metadata.Description},
+		{Name: "owner", Value: metadata.Owner},
+		{Name: "priority", Value: metadata.Priority},
+	} {
+		if "" != p.Value {
+			properties = append(properties, p)
+		}
+	}
+	for _, tag := range metadata.Tags {
+		properties = append(properties, JUnitProperty{Name: "tag", Value: tag})
+	}
+	for _, ticket := range metadata.Tickets {
+		properties = append(properties, JUnitProperty{Name: "ticket", Value: ticket})
+	}
+	if 0 == len(properties) {
+		return nil
+	}
+	return &JUnitProperties{Properties: properties}
+}
+
+/*
+junitSystemOut
+全PhaseのCommand実行結果メッセージをsystem-outとして出力する形式に変換.
+*/
+func junitSystemOut(sc *ScenarioContext) string {
+	var lines []string
+	for _, phase := range ScenarioPhases {
+		for _, r := range sc.PhaseResults(phase) {
+			lines = append(lines, fmt.Sprintf("[%s] %s %s", phase, r.Result, r.Message))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func junitSeconds(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
@@ -0,0 +1,52 @@
+package ettt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+/*
+TestNewJUnitTestSuites シナリオ結果からJUnit XML構造体への変換
+*/
+func TestNewJUnitTestSuites(t *testing.T) {
+	start := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	gc := GlobalContext{
+		profile: Profile{Name: "local"},
+		start:   start,
+		end:     start.Add(3 * time.Second),
+		scenarios: []ExecuteScenario{
+			{ScenarioContext: &ScenarioContext{
+				scenarioName:         "Success",
+				scenarioResultStatus: ScenarioSuccess,
+				durationSeconds:      1,
+				exercisePhaseResults: []CommandResult{{Result: CommandSuccess, Message: "ok"}},
+			}},
+			{ScenarioContext: &ScenarioContext{
+				scenarioName:         "Assertion",
+				scenarioResultStatus: ScenarioAssertionError,
+				verifyPhaseResults:   []CommandResult{{Result: CommandAssertionError, Message: "status mismatch"}},
+			}},
+			{ScenarioContext: &ScenarioContext{
+				scenarioName:         "Failure",
+				scenarioResultStatus: ScenarioFailure,
+				error:                errors.New("connection refused"),
+			}},
+		},
+	}
+
+	suites := NewJUnitTestSuites(gc)
+	if suites.Tests != 3 || suites.Failures != 1 || suites.Errors != 1 || suites.Time != "3.000" {
+		t.Fatalf("failed test %#v", suites)
+	}
+	cases := suites.Suites[0].TestCases
+	if cases[0].Failure != nil || cases[0].Error != nil || cases[0].SystemOut != "[Exercise] CommandSuccess ok" {
+		t.Fatalf("failed test %#v", cases[0])
+	}
+	if cases[1].Failure == nil || cases[1].Failure.Message != "[Verify] status mismatch" {
+		t.Fatalf("failed test %#v", cases[1])
+	}
+	if cases[2].Error == nil || cases[2].Error.Message != "connection refused" {
+		t.Fatalf("failed test %#v", cases[2])
+	}
+}
@@ -0,0 +1,273 @@
+package ettt
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+RunManifest
+実行全体の結果をJSONとして出力するための構造体.
+ダッシュボードや差分ツールが参照する外部向けの契約となるため、
+項目の削除・名称変更を行う場合はManifestVersionを更新すること.
+*/
+type RunManifest struct {
+	Version          int                      `json:"version"`
+	Options          Options                  `json:"options"`
+	ProfileName      string                   `json:"profileName"`
+	ProfileVariables []ProfileVariable        `json:"profileVariables"`
+	Start            time.Time                `json:"start"`
+	End              time.Time                `json:"end"`
+	DurationSeconds  float64                  `json:"durationSeconds"`
+	Scenarios        []ScenarioManifest       `json:"scenarios"`
+	ExtensionErrors  []ExtensionErrorManifest `json:"extensionErrors,omitempty"`
+}
+
+/*
+ScenarioManifest
+シナリオ単位の実行結果.
+*/
+type ScenarioManifest struct {
+	Id              string               `json:"id"`
+	Index           int                  `json:"index"`
+	Name            string               `json:"name"`
+	Metadata        ScenarioMetadata     `json:"metadata"`
+	DependsOn       []string             `json:"dependsOn,omitempty"`
+	Data            *DataRowManifest     `json:"data,omitempty"`
+	Status          ScenarioResultStatus `json:"status"`
+	SkipReason      string               `json:"skipReason,omitempty"`
+	Flaky           bool                 `json:"flaky"`
+	Attempt         int                  `json:"attempt"`
+	Attempts        []AttemptManifest    `json:"attempts,omitempty"`
+	Error           string               `json:"error,omitempty"`
+	PhaseErrors     []PhaseErrorManifest `json:"phaseErrors"`
+	Start           time.Time            `json:"start"`
+	End             time.Time            `json:"end"`
+	DurationSeconds float64              `json:"durationSeconds"`
+	ResultDir       string               `json:"resultDir"`
+	Phases          []PhaseManifest      `json:"phases"`
+}
+
+/*
+DataRowManifest
+データ駆動シナリオのデータ行.
+*/
+type DataRowManifest struct {
+	Index int    `json:"index"`
+	Label string `json:"label"`
+}
+
+/*
+AttemptManifest
+リトライしたシナリオの試行結果.
+*/
+type AttemptManifest struct {
+	Attempt int                  `json:"attempt"`
+	Status  ScenarioResultStatus `json:"status"`
+	Error   string               `json:"error,omitempty"`
+	Start   time.Time            `json:"start"`
+	End     time.Time            `json:"end"`
+}
+
+/*
+ExtensionErrorManifest
+拡張機能のフックで発生したエラー.
+*/
+type ExtensionErrorManifest struct {
+	Key      string `json:"key"`
+	Hook     string `json:"hook"`
+	Scenario string `json:"scenario,omitempty"`
+	Error    string `json:"error"`
+}
+
+/*
+PhaseErrorManifest
+Phase実行時に発生したエラー.
+*/
+type PhaseErrorManifest struct {
+	Phase ScenarioPhase `json:"phase"`
+	Error string        `json:"error"`
+}
+
+/*
+PhaseManifest
+Phase単位のCommand実行結果.
+*/
+type PhaseManifest struct {
+	Phase   ScenarioPhase           `json:"phase"`
+	Results []CommandResultManifest `json:"results"`
+}
+
+/*
+CommandResultManifest
+Command実行結果.
+errorはJSONに変換できないため、メッセージ文字列として出力する.
+*/
+type CommandResultManifest struct {
+	Id               string                `json:"id"`
+	Name             string                `json:"name"`
+	Parameters       map[string]string     `json:"parameters,omitempty"`
+	Result           CommandResultStatus   `json:"result"`
+	Message          string                `json:"message"`
+	CustomReportPath string                `json:"customReportPath,omitempty"`
+	Error            string                `json:"error,omitempty"`
+	Evidences        []Evidence            `json:"evidences"`
+	Start            time.Time             `json:"start"`
+	End              time.Time             `json:"end"`
+	DurationSeconds  float64               `json:"durationSeconds"`
+	Attempt          int                   `json:"attempt"`
+	ScenarioAttempt  int                   `json:"scenarioAttempt"`
+	Retried          bool                  `json:"retried,omitempty"`
+	Observations     []ObservationManifest `json:"observations,omitempty"`
+}
+
+/*
+ObservationManifest
+Eventuallyの試行毎の観測結果.
+*/
+type ObservationManifest struct {
+	Attempt         int                 `json:"attempt"`
+	Result          CommandResultStatus `json:"result"`
+	Message         string              `json:"message"`
+	Error           string              `json:"error,omitempty"`
+	Start           time.Time           `json:"start"`
+	DurationSeconds float64             `json:"durationSeconds"`
+}
+
+/*
+ManifestReport
+実行毎の結果ディレクトリに実行結果のJSON（result.json）を出力する.
+*/
+func ManifestReport(globalContext GlobalContext) error {
+	bytes, err := json.MarshalIndent(NewRunManifest(globalContext), "", "  ")
+	if err != nil {
+		slog.Error("failure marshal manifest.", "error", err)
+		return err
+	}
+	path := filepath.Join(globalContext.executionResultDir, DefaultManifestPath)
+	if err := os.WriteFile(path, bytes, 0o644); err != nil {
+		slog.Error("failure write manifest.", "error", err, "path", path)
+		return err
+	}
+	return nil
+}
+
+/*
+NewRunManifest
+全体コンテキストから実行結果のJSON構造体を作成.
+*/
+func NewRunManifest(globalContext GlobalContext) RunManifest {
+	manifest := RunManifest{
+		Version:          ManifestVersion,
+		Options:          globalContext.options,
+		ProfileName:      globalContext.profile.Name,
+		ProfileVariables: maskedProfileVariables(globalContext.profile),
+		Start:            globalContext.start,
+		End:              globalContext.end,
+		DurationSeconds:  globalContext.end.Sub(globalContext.start).Seconds(),
+		Scenarios:        make([]ScenarioManifest, 0, len(globalContext.scenarios)),
+	}
+	for _, v := range globalContext.scenarios {
+		manifest.Scenarios = append(manifest.Scenarios, newScenarioManifest(v.ScenarioContext))
+	}
+	for _, e := range globalContext.ExtensionErrors() {
+		manifest.ExtensionErrors = append(manifest.ExtensionErrors, ExtensionErrorManifest{
+			Key:      e.Key,
+			Hook:     e.Hook,
+			Scenario: e.Scenario,
+			Error:    e.Err.Error(),
+		})
+	}
+	return manifest
+}
+
+func newScenarioManifest(sc *ScenarioContext) ScenarioManifest {
+	scenario := ScenarioManifest{
+		Id:              sc.id.String(),
+		Index:           sc.index,
+		Name:            sc.scenarioName,
+		Metadata:        sc.metadata,
+		DependsOn:       sc.dependsOn,
+		Status:          sc.scenarioResultStatus,
+		SkipReason:      sc.skipReason,
+		Flaky:           sc.flaky,
+		Attempt:         sc.attempt,
+		Start:           sc.start,
+		End:             sc.end,
+		DurationSeconds: sc.durationSeconds,
+		ResultDir:       sc.scenarioResultDir,
+		PhaseErrors:     make([]PhaseErrorManifest, 0, len(sc.phaseErrors)),
+		Phases:          make([]PhaseManifest, 0, len(ScenarioPhases)),
+	}
+	if sc.error != nil {
+		scenario.Error = sc.error.Error()
+	}
+	if sc.data != nil {
+		scenario.Data = &DataRowManifest{Index: sc.data.Index, Label: sc.data.Label}
+	}
+	for _, v := range sc.attempts {
+		attempt := AttemptManifest{Attempt: v.Attempt, Status: v.Status, Start: v.Start, End: v.End}
+		if v.Err != nil {
+			attempt.Error = v.Err.Error()
+		}
+		scenario.Attempts = append(scenario.Attempts, attempt)
+	}
+	for _, v := range sc.phaseErrors {
+		scenario.PhaseErrors = append(scenario.PhaseErrors, PhaseErrorManifest{
+			Phase: v.Phase,
+			Error: v.Err.Error(),
+		})
+	}
+	for _, phase := range ScenarioPhases {
+		results := make([]CommandResultManifest, 0)
+		for _, r := range sc.PhaseResults(phase) {
+			results = append(results, newCommandResultManifest(r))
+		}
+		scenario.Phases = append(scenario.Phases, PhaseManifest{
+			Phase:   phase,
+			Results: results,
+		})
+	}
+	return scenario
+}
+
+func newCommandResultManifest(r CommandResult) CommandResultManifest {
+	result := CommandResultManifest{
+		Id:               r.Id.String(),
+		Name:             r.Name,
+		Parameters:       r.Parameters,
+		Result:           r.Result,
+		Message:          r.Message,
+		CustomReportPath: r.CustomReportPath,
+		Evidences:        r.Evidences,
+		Start:            r.Start,
+		End:              r.End,
+		DurationSeconds:  r.DurationSeconds,
+		Attempt:          r.Attempt,
+		ScenarioAttempt:  r.ScenarioAttempt,
+		Retried:          r.Retried,
+	}
+	if result.Evidences == nil {
+		result.Evidences = make([]Evidence, 0)
+	}
+	if r.Error != nil {
+		result.Error = r.Error.Error()
+	}
+	for _, o := range r.Observations {
+		observation := ObservationManifest{
+			Attempt:         o.Attempt,
+			Result:          o.Result,
+			Message:         o.Message,
+			Start:           o.Start,
+			DurationSeconds: o.DurationSeconds,
+		}
+		if o.Error != nil {
+			observation.Error = o.Error.Error()
+		}
+		result.Observations = append(result.Observations, observation)
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+package ettt
+
+import (
+	"fmt"
+	"regexp"
+)
+
+/*
+ScenarioNameFilter
+シナリオ名に対する正規表現による選択.
+runの正規表現に一致し、skipの正規表現に一致しないシナリオを選択する.
+空の正規表現は指定なしとして扱う.
+*/
+type ScenarioNameFilter struct {
+	run  *regexp.Regexp
+	skip *regexp.Regexp
+}
+
+/*
+ParseScenarioNameFilter
+シナリオ名の選択に利用する正規表現を解析.
+*/
+func ParseScenarioNameFilter(runExpr string, skipExpr string) (ScenarioNameFilter, error) {
+	var f ScenarioNameFilter
+	var err error
+	if "" != runExpr {
+		if f.run, err = regexp.Compile(runExpr); err != nil {
+			return ScenarioNameFilter{}, fmt.Errorf("invalid run expression. expression : %s. %w", runExpr, err)
+		}
+	}
+	if "" != skipExpr {
+		if f.skip, err = regexp.Compile(skipExpr); err != nil {
+			return ScenarioNameFilter{}, fmt.Errorf("invalid skip expression. expression : %s. %w", skipExpr, err)
+		}
+	}
+	return f, nil
+}
+
+/*
+Match
+シナリオ名が選択されるか判定.
+*/
+func (f ScenarioNameFilter) Match(name string) bool {
+	if f.run != nil && !f.run.MatchString(name) {
+		return false
+	}
+	return f.skip == nil || !f.skip.MatchString(name)
+}
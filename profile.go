@@ -1,15 +1,27 @@
 package ettt
 
 import (
+	"fmt"
 	"gopkg.in/yaml.v3"
 	"log/slog"
 	"os"
+	"sort"
+	"strings"
 )
 
 const (
 	// ProfilePathDefault デフォルトのProfile読み込みパス.
 	ProfilePathDefault string = "./profiles/"
 	ProfileDefault     string = "default"
+	// ProfileSeparator 複数Profile指定時の区切り文字.
+	ProfileSeparator string = ","
+	// ProfileEnvPrefix Profile変数を上書きする環境変数の接頭辞.
+	// ETTT_PROFILE_baseUrl=http://localhost の場合、baseUrl を上書きする.
+	ProfileEnvPrefix string = "ETTT_PROFILE_"
+	// ProfileSourceEnv 環境変数で上書きした変数の出所.
+	ProfileSourceEnv string = "env"
+	// ProfileSourceOption オプションで上書きした変数の出所.
+	ProfileSourceOption string = "option"
 )
 
 /*
@@ -17,17 +29,94 @@ Profile
 Profile設定ファイルを保持する構造体
 */
 type Profile struct {
-	Name      string
+	Name string
+	// 継承する親Profile名.
+	// 親Profileの変数に自身の変数を上書きしてマージする.
+	Extends   ProfileExtends
 	Variables []ProfileVariable
+	// キーからVariablesのインデックスへの索引.
+	// 読み込み時に作成し、変数の参照を定数時間で行う.
+	index map[string]int
 }
 
 /*
 ProfileVariable
 Profile設定ファイル中のKey=Value保持
+Valueには入れ子のMapやリストも指定できる.
 */
 type ProfileVariable struct {
-	Key   string
-	Value string
+	Key string `json:"key"`
+	// 文字列に変換した値. Map・リストの場合はJSON文字列となる.
+	Value string `json:"value"`
+	// Map・リストの場合の構造化された値（map[string]any, []any）.
+	// スカラー値の場合はnil.
+	Data any `json:"-"`
+	// 変数の出所（Profile設定ファイルのパス、env、option）
+	Source string `yaml:"-" json:"source"`
+	// 秘匿値. ログやレポートではマスクされる.
+	// 外部参照（${env:...}, ${file:...}）や暗号化値（enc:...）を含む場合は自動で秘匿値となる.
+	Secret bool `json:"secret"`
+}
+
+func (v *ProfileVariable) UnmarshalYAML(node *yaml.Node) error {
+	var raw struct {
+		Key    string    `yaml:"key"`
+		Value  yaml.Node `yaml:"value"`
+		Secret bool      `yaml:"secret"`
+	}
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	v.Key = raw.Key
+	v.Secret = raw.Secret
+	switch {
+	case 0 == raw.Value.Kind || "!!null" == raw.Value.Tag:
+		// 値の指定なし
+	default:
+		// スカラー値も入れ子の値と同じく解釈した値を文字列に変換する（0x1F → 31, 1e3 → 1000）
+		var data any
+		if err := raw.Value.Decode(&data); err != nil {
+			return fmt.Errorf("invalid profile variable %s. %w", raw.Key, err)
+		}
+		data = normalizeVariableValue(data)
+		switch data.(type) {
+		case map[string]any, []any:
+			v.Data = data
+		}
+		v.Value = formatVariableValue(data)
+	}
+	return nil
+}
+
+/*
+value
+変数パスで参照する値.
+*/
+func (v ProfileVariable) value() any {
+	if v.Data != nil {
+		return v.Data
+	}
+	return v.Value
+}
+
+/*
+ProfileExtends
+継承する親Profile名のリスト.
+YAML上は単一の文字列、文字列のリストのどちらでも指定できる.
+*/
+type ProfileExtends []string
+
+func (e *ProfileExtends) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*e = ProfileExtends{value.Value}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*e = list
+	return nil
 }
 
 func ParseProfile(target string) (Profile, error) {
@@ -36,7 +125,7 @@ func ParseProfile(target string) (Profile, error) {
 	// Read Yaml File
 	var bytes, err = os.ReadFile(target)
 	if err != nil {
-		slog.Error("read profile failure.", err, "source", target)
+		slog.Error("read profile failure.", "error", err, "source", target)
 		// 空とエラーを返却
 		return Profile{}, err
 	}
@@ -45,9 +134,237 @@ func ParseProfile(target string) (Profile, error) {
 	profileVariables := Profile{}
 	err = yaml.Unmarshal(bytes, &profileVariables)
 	if err != nil {
-		slog.Error("parse profile failure.", err, "source", target)
+		slog.Error("parse profile failure.", "error", err, "source", target)
 		// 空とエラーを返却
 		return Profile{}, err
 	}
+	for i := range profileVariables.Variables {
+		profileVariables.Variables[i].Source = target
+	}
 	return profileVariables, nil
 }
+
+/*
+LoadProfile
+オプションに従ってProfileを読み込みマージする.
+マージの優先度は以下の通り（後勝ち）.
+ 1. 指定されたProfileを指定順に（各Profileは継承元の親Profileを先に）
+    継承元として読み込み済みのProfileも、明示的に指定された位置で改めてマージする
+ 2. 環境変数（ProfileEnvPrefix）
+ 3. オプション（Options.ProfileOverrides）
+
+マージ後に秘匿値の外部参照・暗号化値を解決する.
+*/
+func LoadProfile(options Options) (Profile, error) {
+	names := profileNames(options)
+	merged := Profile{Name: strings.Join(names, ProfileSeparator)}
+	parsed := make(map[string]Profile)
+	for _, name := range names {
+		if err := loadProfileHierarchy(options, name, nil, make(map[string]bool), parsed, &merged); err != nil {
+			return Profile{}, err
+		}
+	}
+
+	// 環境変数による上書き
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, ProfileEnvPrefix) {
+			continue
+		}
+		key, value, _ := strings.Cut(strings.TrimPrefix(env, ProfileEnvPrefix), "=")
+		merged.override(ProfileVariable{Key: key, Value: value, Source: ProfileSourceEnv})
+	}
+
+	// オプションによる上書き
+	keys := make([]string, 0, len(options.ProfileOverrides))
+	for k := range options.ProfileOverrides {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		merged.override(ProfileVariable{Key: k, Value: options.ProfileOverrides[k], Source: ProfileSourceOption})
+	}
+
+	// 秘匿値の解決と登録
+	if err := resolveSecrets(options, &merged); err != nil {
+		return Profile{}, err
+	}
+	return merged, nil
+}
+
+/*
+loadProfileHierarchy
+親Profileから順に読み込んでマージする.
+1つの指定Profileの継承階層内では同一Profileを一度だけマージし、継承の循環はエラーとする.
+解析済みのProfileはparsedに保持し、指定Profile間で再利用する.
+*/
+func loadProfileHierarchy(options Options, name string, chain []string, loaded map[string]bool, parsed map[string]Profile, merged *Profile) error {
+	for _, v := range chain {
+		if v == name {
+			return fmt.Errorf("profile extends cycle detected. %s", strings.Join(append(chain, name), " -> "))
+		}
+	}
+	if loaded[name] {
+		return nil
+	}
+	profile, ok := parsed[name]
+	if !ok {
+		var err error
+		if profile, err = ParseProfile(resolveProfile(options, name)); err != nil {
+			return err
+		}
+		parsed[name] = profile
+	}
+	for _, parent := range profile.Extends {
+		if err := loadProfileHierarchy(options, parent, append(chain, name), loaded, parsed, merged); err != nil {
+			return err
+		}
+	}
+	for _, v := range profile.Variables {
+		merged.override(v)
+	}
+	loaded[name] = true
+	return nil
+}
+
+/*
+override
+変数を上書きする. 存在しない場合は末尾に追加する.
+*/
+func (p *Profile) override(variable ProfileVariable) {
+	if p.index == nil {
+		p.buildIndex()
+	}
+	if i, ok := p.index[variable.Key]; ok {
+		// 秘匿値は上書き後も秘匿値として扱う
+		variable.Secret = variable.Secret || p.Variables[i].Secret
+		p.Variables[i] = variable
+		return
+	}
+	p.index[variable.Key] = len(p.Variables)
+	p.Variables = append(p.Variables, variable)
+}
+
+/*
+profileNames
+オプションで指定されたProfile名のリスト.
+指定がない場合はデフォルトのProfileとなる.
+*/
+func profileNames(options Options) []string {
+	var names []string
+	for _, v := range strings.Split(options.Profile, ProfileSeparator) {
+		if v = strings.TrimSpace(v); "" != v {
+			names = append(names, v)
+		}
+	}
+	if 0 == len(names) {
+		return []string{ProfileDefault}
+	}
+	return names
+}
+
+/*
+buildIndex
+変数の索引を作成する.
+*/
+func (p *Profile) buildIndex() {
+	p.index = make(map[string]int, len(p.Variables))
+	for i, v := range p.Variables {
+		p.index[v.Key] = i
+	}
+}
+
+/*
+Get
+変数を取得.
+*/
+func (p Profile) Get(key string) (ProfileVariable, bool) {
+	if p.index != nil && len(p.index) == len(p.Variables) {
+		i, ok := p.index[key]
+		if !ok {
+			return ProfileVariable{}, false
+		}
+		if p.Variables[i].Key == key {
+			return p.Variables[i], true
+		}
+	}
+	// 索引がない、または索引の作成後に変数が変更された場合は走査する
+	for _, v := range p.Variables {
+		if v.Key == key {
+			return v, true
+		}
+	}
+	return ProfileVariable{}, false
+}
+
+/*
+Lookup
+変数パス（users[1].name など）で値を取得.
+スカラー値は文字列、Mapはmap[string]any、リストは[]anyとなる.
+*/
+func (p Profile) Lookup(path string) (any, error) {
+	segments, err := parseVariablePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return p.lookup(segments)
+}
+
+func (p Profile) lookup(segments []variablePathSegment) (any, error) {
+	if segments[0].isIndex {
+		return nil, fmt.Errorf("variable path must start with key")
+	}
+	v, ok := p.Get(segments[0].key)
+	if !ok {
+		return nil, fmt.Errorf("profile variable %s not found", segments[0].key)
+	}
+	return lookupVariablePath(v.value(), segments[1:])
+}
+
+/*
+GetString
+変数パスで値を文字列として取得.
+Map・リストの場合はJSON文字列となる.
+*/
+func (p Profile) GetString(path string) (string, error) {
+	v, err := p.Lookup(path)
+	if err != nil {
+		return "", err
+	}
+	return formatVariableValue(v), nil
+}
+
+/*
+GetNumber
+変数パスで値を数値として取得.
+*/
+func (p Profile) GetNumber(path string) (float64, error) {
+	v, err := p.Lookup(path)
+	if err != nil {
+		return 0, err
+	}
+	return variableNumber(v)
+}
+
+/*
+GetBool
+変数パスで値を真偽値として取得.
+*/
+func (p Profile) GetBool(path string) (bool, error) {
+	v, err := p.Lookup(path)
+	if err != nil {
+		return false, err
+	}
+	return variableBool(v)
+}
+
+/*
+GetJSON
+変数パスで値を指定した構造体に変換して取得.
+*/
+func (p Profile) GetJSON(path string, out any) error {
+	v, err := p.Lookup(path)
+	if err != nil {
+		return err
+	}
+	return decodeVariableValue(v, out)
+}
@@ -0,0 +1,196 @@
+package ettt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+writeProfiles テスト用のProfile設定ファイルを一時ディレクトリに作成する.
+*/
+func writeProfiles(t *testing.T, profiles map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range profiles {
+		if err := os.WriteFile(filepath.Join(dir, name+".yaml"), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed write profile %#v", err)
+		}
+	}
+	return dir
+}
+
+/*
+TestLoadProfile Profileの継承・マージ・上書き
+*/
+func TestLoadProfile(t *testing.T) {
+	dir := writeProfiles(t, map[string]string{
+		"base":    "name: base\nvariables:\n  - key: host\n    value: localhost\n  - key: port\n    value: \"80\"\n  - key: user\n    value: guest\n",
+		"staging": "name: staging\nextends: base\nvariables:\n  - key: host\n    value: staging.example.com\n",
+		"feature": "name: feature\nextends: [staging]\nvariables:\n  - key: port\n    value: \"8080\"\n",
+		"cycle1":  "name: cycle1\nextends: cycle2\n",
+		"cycle2":  "name: cycle2\nextends: cycle1\n",
+	})
+
+	t.Run("継承と複数指定のマージ・環境変数とオプションによる上書き", func(t *testing.T) {
+		t.Setenv(ProfileEnvPrefix+"user", "env-user")
+		profile, err := LoadProfile(Options{
+			Profile:          "base,feature",
+			ProfilePath:      dir,
+			ProfileOverrides: map[string]string{"token": "abc"},
+		})
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		expected := map[string][2]string{
+			"host":  {"staging.example.com", filepath.Join(dir, "staging.yaml")},
+			"port":  {"8080", filepath.Join(dir, "feature.yaml")},
+			"user":  {"env-user", ProfileSourceEnv},
+			"token": {"abc", ProfileSourceOption},
+		}
+		if profile.Name != "base,feature" || len(profile.Variables) != len(expected) {
+			t.Fatalf("failed test %#v", profile)
+		}
+		for _, v := range profile.Variables {
+			if e := expected[v.Key]; e[0] != v.Value || e[1] != v.Source {
+				t.Fatalf("failed test %#v", v)
+			}
+		}
+	})
+	t.Run("継承元のProfileを後に指定した場合は継承元の値が優先", func(t *testing.T) {
+		profile, err := LoadProfile(Options{Profile: "staging,base", ProfilePath: dir})
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if v, _ := profile.Get("host"); "localhost" != v.Value || filepath.Join(dir, "base.yaml") != v.Source {
+			t.Fatalf("failed test %#v", v)
+		}
+	})
+	t.Run("継承の循環", func(t *testing.T) {
+		_, err := LoadProfile(Options{Profile: "cycle1", ProfilePath: dir})
+		if err == nil || !strings.Contains(err.Error(), "cycle1 -> cycle2 -> cycle1") {
+			t.Fatalf("failed test %#v", err)
+		}
+	})
+}
+
+/*
+TestStructuredProfile 入れ子のMap・リストを持つProfile変数
+*/
+func TestStructuredProfile(t *testing.T) {
+	dir := writeProfiles(t, map[string]string{
+		"default": `name: default
+variables:
+  - key: port
+    value: 8080
+  - key: db
+    value:
+      host: db.local
+      port: 5432
+      ssl: true
+  - key: users
+    value:
+      - name: alice
+        roles: [admin]
+      - name: bob
+        roles: [viewer, editor]
+  - key: hex
+    value: 0x1F
+  - key: exponent
+    value: 1e3
+  - key: float
+    value: 0.50
+  - key: empty
+    value: ~
+  - key: quoted
+    value: "0x1F"
+  - key: scalars
+    value:
+      hex: 0x1F
+      exponent: 1e3
+      float: 0.50
+      empty: ~
+`,
+	})
+	profile, err := LoadProfile(Options{ProfilePath: dir})
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+
+	t.Run("スカラー値は文字列として保持", func(t *testing.T) {
+		v, ok := profile.Get("port")
+		if !ok || "8080" != v.Value || v.Data != nil {
+			t.Fatalf("failed test %#v", v)
+		}
+	})
+	t.Run("スカラー値は入れ子の値と同じ表記に正規化", func(t *testing.T) {
+		for _, key := range []string{"hex", "exponent", "float", "empty"} {
+			v, ok := profile.Get(key)
+			if !ok || v.Data != nil {
+				t.Fatalf("failed test %s %#v", key, v)
+			}
+			nested, err := profile.GetString("scalars." + key)
+			if err != nil || nested != v.Value {
+				t.Fatalf("failed test %s %#v %#v %#v", key, v.Value, nested, err)
+			}
+		}
+		if v, _ := profile.Get("hex"); "31" != v.Value {
+			t.Fatalf("failed test %#v", v)
+		}
+		if v, _ := profile.Get("quoted"); "0x1F" != v.Value {
+			t.Fatalf("failed test %#v", v)
+		}
+	})
+	t.Run("Map・リストはJSON文字列と構造化された値を保持", func(t *testing.T) {
+		v, _ := profile.Get("db")
+		if `{"host":"db.local","port":5432,"ssl":true}` != v.Value {
+			t.Fatalf("failed test %#v", v)
+		}
+	})
+	t.Run("型付きアクセサ", func(t *testing.T) {
+		if host, err := profile.GetString("db.host"); err != nil || "db.local" != host {
+			t.Fatalf("failed test %#v %#v", host, err)
+		}
+		if port, err := profile.GetNumber("db.port"); err != nil || 5432 != port {
+			t.Fatalf("failed test %#v %#v", port, err)
+		}
+		if port, err := profile.GetNumber("port"); err != nil || 8080 != port {
+			t.Fatalf("failed test %#v %#v", port, err)
+		}
+		if ssl, err := profile.GetBool("db.ssl"); err != nil || !ssl {
+			t.Fatalf("failed test %#v %#v", ssl, err)
+		}
+		var users []struct {
+			Name  string   `json:"name"`
+			Roles []string `json:"roles"`
+		}
+		if err := profile.GetJSON("users", &users); err != nil || 2 != len(users) || "editor" != users[1].Roles[1] {
+			t.Fatalf("failed test %#v %#v", users, err)
+		}
+		if _, err := profile.GetString("users[2].name"); err == nil {
+			t.Fatal("failed test")
+		}
+	})
+}
+
+/*
+TestProfileIndex 索引による変数の取得
+*/
+func TestProfileIndex(t *testing.T) {
+	var profile Profile
+	profile.override(ProfileVariable{Key: "a", Value: "1"})
+	profile.override(ProfileVariable{Key: "b", Value: "2"})
+	profile.override(ProfileVariable{Key: "a", Value: "3"})
+	if v, ok := profile.Get("a"); !ok || "3" != v.Value || 2 != len(profile.Variables) {
+		t.Fatalf("failed test %#v", profile)
+	}
+	if _, ok := profile.Get("c"); ok {
+		t.Fatal("failed test")
+	}
+	// 索引の作成後に追加された変数も取得できる
+	profile.Variables = append(profile.Variables, ProfileVariable{Key: "c", Value: "4"})
+	if v, ok := profile.Get("c"); !ok || "4" != v.Value {
+		t.Fatalf("failed test %#v", profile)
+	}
+}
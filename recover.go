@@ -0,0 +1,29 @@
+package ettt
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+/*
+PanicError
+ScenarioやCommandの実行中に発生したpanicを変換したエラー.
+*/
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.Value, e.Stack)
+}
+
+/*
+recoverPanic
+deferで呼び出し、panicを捕捉してPanicErrorとして指定のエラーに設定する.
+*/
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{Value: r, Stack: debug.Stack()}
+	}
+}
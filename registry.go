@@ -0,0 +1,67 @@
+package ettt
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+/*
+NamedScenario
+名前付きシナリオ.
+レジストリへの登録単位であり、NewNamedへの入力となる.
+*/
+type NamedScenario struct {
+	Name     string
+	Scenario Scenario
+}
+
+/*
+シナリオレジストリ.
+各シナリオパッケージのinit()から登録される.
+*/
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Scenario)
+)
+
+/*
+RegisterScenario
+シナリオを名前付きでレジストリに登録する.
+シナリオパッケージのinit()から呼び出すことを想定している.
+名前が空、シナリオがnil、名前が重複している場合はpanicとなる.
+*/
+func RegisterScenario(name string, scenario Scenario) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if "" == name {
+		panic("ettt: RegisterScenario name is empty")
+	}
+	if scenario == nil {
+		panic("ettt: RegisterScenario scenario is nil. name : " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("ettt: RegisterScenario called twice for scenario %s", name))
+	}
+	registry[name] = scenario
+}
+
+/*
+RegisteredScenarios
+レジストリに登録されたシナリオを名前順で取得する.
+*/
+func RegisteredScenarios() []NamedScenario {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	scenarios := make([]NamedScenario, 0, len(registry))
+	for name, scenario := range registry {
+		scenarios = append(scenarios, NamedScenario{
+			Name:     name,
+			Scenario: scenario,
+		})
+	}
+	sort.Slice(scenarios, func(i, j int) bool {
+		return scenarios[i].Name < scenarios[j].Name
+	})
+	return scenarios
+}
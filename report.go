@@ -1,34 +1,172 @@
 package ettt
 
 import (
+	"embed"
 	"html/template"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"time"
 )
 
+/*
+ツールオリジナルのレポートテンプレート.
+実行ディレクトリに依存しないようにバイナリへ埋め込む.
+*/
+//go:embed template/*.html
+var embeddedTemplates embed.FS
+
+/*
+GlobalReportData
+全体レポート（index.html）のテンプレートに渡すデータ.
+*/
+type GlobalReportData struct {
+	ProfileName      string
+	ProfileVariables []ProfileVariable
+	Start            time.Time
+	End              time.Time
+	DurationSeconds  float64
+	Summary          map[ScenarioResultStatus]int
+	Scenarios        []ScenarioReportData
+	ExtensionErrors  []*ExtensionError
+}
+
+/*
+ScenarioReportData
+シナリオ詳細レポート（result.html）のテンプレートに渡すデータ.
+*/
+type ScenarioReportData struct {
+	*ScenarioContext
+	// 全体レポートからシナリオ詳細レポートへの相対パス
+	DetailPath string
+	Phases     []PhaseReportData
+}
+
+/*
+PhaseReportData
+Phase毎のCommand実行結果.
+*/
+type PhaseReportData struct {
+	Phase   ScenarioPhase
+	Results []CommandResult
+}
+
+/*
+GlobalReport
+実行毎の結果ディレクトリに全体レポート（index.html）を出力する.
+*/
 func GlobalReport(globalContext GlobalContext) error {
-	return nil
+	t, err := parseReportTemplate(globalContext, DefaultReportTemplateIndexPath)
+	if err != nil {
+		return err
+	}
+
+	data := GlobalReportData{
+		ProfileName:      globalContext.profile.Name,
+		ProfileVariables: maskedProfileVariables(globalContext.profile),
+		Start:            globalContext.start,
+		End:              globalContext.end,
+		DurationSeconds:  globalContext.end.Sub(globalContext.start).Seconds(),
+		Summary:          make(map[ScenarioResultStatus]int),
+		ExtensionErrors:  globalContext.ExtensionErrors(),
+	}
+	for _, v := range globalContext.scenarios {
+		data.Summary[v.scenarioResultStatus]++
+		data.Scenarios = append(data.Scenarios, newScenarioReportData(globalContext, v.ScenarioContext))
+	}
+
+	return writeReport(t, filepath.Join(globalContext.executionResultDir, DefaultReportTemplateIndexPath), data)
 }
 
-func ScenarioReport(globalContext GlobalContext, scenarioContext ScenarioContext) error {
-	// カスタムテンプレートディレクトリが指定されていなければ、ツールオリジナルを利用する
-	var templateDirPath string = ""
+/*
+ScenarioReport
+シナリオの詳細レポートディレクトリにシナリオ詳細レポート（result.html）を出力する.
+*/
+func ScenarioReport(globalContext GlobalContext, scenarioContext *ScenarioContext) error {
+	if "" == scenarioContext.detailsDir {
+		slog.Warn("skip scenario report. details dir is not created.", "name", scenarioContext.scenarioName)
+		return nil
+	}
+	t, err := parseReportTemplate(globalContext, DefaultReportTemplateResultPath)
+	if err != nil {
+		return err
+	}
+	return writeReport(t,
+		filepath.Join(scenarioContext.detailsDir, DefaultReportTemplateResultPath),
+		newScenarioReportData(globalContext, scenarioContext))
+}
+
+/*
+newScenarioReportData
+テンプレートに渡すシナリオ単位のデータを作成.
+*/
+func newScenarioReportData(globalContext GlobalContext, scenarioContext *ScenarioContext) ScenarioReportData {
+	data := ScenarioReportData{
+		ScenarioContext: scenarioContext,
+	}
+	if "" != scenarioContext.detailsDir {
+		rel, err := filepath.Rel(globalContext.executionResultDir,
+			filepath.Join(scenarioContext.detailsDir, DefaultReportTemplateResultPath))
+		if err == nil {
+			data.DetailPath = filepath.ToSlash(rel)
+		}
+	}
+	for _, phase := range ScenarioPhases {
+		data.Phases = append(data.Phases, PhaseReportData{
+			Phase:   phase,
+			Results: scenarioContext.PhaseResults(phase),
+		})
+	}
+	return data
+}
+
+/*
+レポートテンプレートで利用可能な関数.
+*/
+var reportFuncs = template.FuncMap{
+	// relPath base から target への相対パス（リンク用）
+	"relPath": func(base string, target string) string {
+		rel, err := filepath.Rel(base, target)
+		if err != nil {
+			return filepath.ToSlash(target)
+		}
+		return filepath.ToSlash(rel)
+	},
+}
+
+/*
+parseReportTemplate
+レポートテンプレートの読み込み.
+カスタムテンプレートディレクトリが指定されていなければ、ツールオリジナルを利用する.
+*/
+func parseReportTemplate(globalContext GlobalContext, name string) (*template.Template, error) {
+	var t = template.New(name).Funcs(reportFuncs)
+	var err error
 	if "" == globalContext.options.TemplateDirPath {
-		templateDirPath = DefaultReportTemplateDirPath
+		t, err = t.ParseFS(embeddedTemplates, DefaultReportTemplateDirPath+"/"+name)
 	} else {
-		templateDirPath = globalContext.options.TemplateDirPath
+		t, err = t.ParseFiles(filepath.Join(globalContext.options.TemplateDirPath, name))
 	}
-
-	t, err := template.ParseGlob(templateDirPath + "/" + DefaultReportTemplateResultPath)
 	if err != nil {
-		log.Fatalf("template error: %v", err)
+		slog.Error("template parse failure.", "error", err, "template", name)
+		return nil, err
 	}
+	return t, nil
+}
 
-	if err := t.Execute(os.Stdout, scenarioContext); err != nil {
-		log.Printf("failed to execute template: %v", err)
-	}
+/*
+writeReport
+テンプレートを適用してレポートファイルを出力.
+*/
+func writeReport(t *template.Template, path string, data any) error {
+	f, err := os.Create(path)
 	if err != nil {
-		log.Fatalf("template error: %v", err)
+		slog.Error("failure create report file.", "error", err, "path", path)
+		return err
+	}
+	defer f.Close()
+	if err := t.Execute(f, data); err != nil {
+		slog.Error("failed to execute template.", "error", err, "path", path)
 		return err
 	}
 	return nil
@@ -0,0 +1,182 @@
+package ettt
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+/*
+TestGlobalReport 全体レポートとシナリオ詳細レポートの出力
+*/
+func TestGlobalReport(t *testing.T) {
+	var executed int32
+	scenarios := []Scenario{sleepScenario{probe: &concurrencyProbe{}, executed: &executed}}
+	engine, err := New(scenarios, nil, testOptions(t))
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	if err := engine.Run(); err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+
+	index, err := os.ReadFile(filepath.Join(engine.ExecutionResultDir(), DefaultReportTemplateIndexPath))
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	es := engine.Scenarios()[0]
+	detail, err := filepath.Rel(engine.ExecutionResultDir(), filepath.Join(es.DetailsDir(), DefaultReportTemplateResultPath))
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	if !strings.Contains(string(index), `href="`+filepath.ToSlash(detail)+`"`) {
+		t.Fatalf("failed test index does not link to detail %s", detail)
+	}
+
+	result, err := os.ReadFile(filepath.Join(es.DetailsDir(), DefaultReportTemplateResultPath))
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	if !strings.Contains(string(result), es.Id().String()) || !strings.Contains(string(result), string(ScenarioSuccess)) {
+		t.Fatal("failed test")
+	}
+}
+
+/*
+TestManifestReport 実行結果JSONの出力
+*/
+func TestManifestReport(t *testing.T) {
+	var executed int32
+	scenarios := []Scenario{sleepScenario{probe: &concurrencyProbe{}, executed: &executed}}
+	options := testOptions(t)
+	engine, err := New(scenarios, nil, options)
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	if err := engine.Run(); err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+
+	bytes, err := os.ReadFile(filepath.Join(engine.ExecutionResultDir(), DefaultManifestPath))
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	var manifest RunManifest
+	if err := json.Unmarshal(bytes, &manifest); err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	if manifest.Version != ManifestVersion || manifest.ProfileName != "test" || !reflect.DeepEqual(manifest.Options, options) {
+		t.Fatalf("failed test %#v", manifest)
+	}
+	if len(manifest.Scenarios) != 1 || len(manifest.Scenarios[0].Phases) != len(ScenarioPhases) {
+		t.Fatalf("failed test %#v", manifest.Scenarios)
+	}
+	s := manifest.Scenarios[0]
+	if s.Id != engine.Scenarios()[0].Id().String() || s.Name != "sleepScenario" || s.Status != ScenarioSuccess {
+		t.Fatalf("failed test %#v", s)
+	}
+}
+
+/*
+metadataScenario メタデータを指定したテスト用シナリオ.
+*/
+type metadataScenario struct {
+	funcScenario
+	metadata ScenarioMetadata
+}
+
+func (s metadataScenario) Metadata() ScenarioMetadata {
+	return s.metadata
+}
+
+/*
+TestScenarioMetadataReport タグ選択式による実行対象の選択とメタデータのレポート出力
+*/
+func TestScenarioMetadataReport(t *testing.T) {
+	var executed int32
+	exercise := func(gc GlobalContext, sc *ScenarioContext) error {
+		atomic.AddInt32(&executed, 1)
+		return nil
+	}
+	smoke := metadataScenario{
+		funcScenario: funcScenario{exercise: exercise},
+		metadata: ScenarioMetadata{
+			DisplayName: "ログイン",
+			Description: "正しいパスワードでログインできる",
+			Tags:        []string{"smoke", "auth"},
+			Owner:       "auth-team",
+			Priority:    "P1",
+			Tickets:     []string{"AUTH-101"},
+		},
+	}
+	slow := metadataScenario{
+		funcScenario: funcScenario{exercise: exercise},
+		metadata:     ScenarioMetadata{Tags: []string{"smoke", "slow"}},
+	}
+	options := testOptions(t)
+	options.TagExpression = "smoke && !slow"
+	engine, err := New([]Scenario{smoke, slow, funcScenario{exercise: exercise}}, nil, options)
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	if err := engine.Run(); err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+
+	scenarios := engine.Scenarios()
+	if 1 != executed || ScenarioSuccess != engine.ResultStatus() {
+		t.Fatalf("failed test executed=%d status=%s", executed, engine.ResultStatus())
+	}
+	if "ログイン" != scenarios[0].ScenarioName() || ScenarioSuccess != scenarios[0].ResultStatus() {
+		t.Fatalf("failed test %s %s", scenarios[0].ScenarioName(), scenarios[0].ResultStatus())
+	}
+	for _, sc := range scenarios[1:] {
+		if ScenarioNotRun != sc.ResultStatus() || !strings.Contains(sc.SkipReason(), "smoke && !slow") || "" != sc.ScenarioResultDir() {
+			t.Fatalf("failed test %s %s", sc.ResultStatus(), sc.SkipReason())
+		}
+	}
+
+	bytes, err := os.ReadFile(filepath.Join(engine.ExecutionResultDir(), DefaultManifestPath))
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	var manifest RunManifest
+	if err := json.Unmarshal(bytes, &manifest); err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	if 3 != len(manifest.Scenarios) || !reflect.DeepEqual(manifest.Scenarios[0].Metadata, smoke.metadata) ||
+		ScenarioNotRun != manifest.Scenarios[1].Status || "" == manifest.Scenarios[1].SkipReason {
+		t.Fatalf("failed test %#v", manifest.Scenarios)
+	}
+
+	junit, err := os.ReadFile(filepath.Join(engine.ExecutionResultDir(), DefaultJUnitReportPath))
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	for _, expected := range []string{`skipped="2"`, `<property name="owner" value="auth-team"></property>`, `<property name="ticket" value="AUTH-101"></property>`, `<skipped message="excluded by tag expression`} {
+		if !strings.Contains(string(junit), expected) {
+			t.Fatalf("failed test %s\n%s", expected, junit)
+		}
+	}
+
+	index, err := os.ReadFile(filepath.Join(engine.ExecutionResultDir(), DefaultReportTemplateIndexPath))
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	for _, expected := range []string{"正しいパスワードでログインできる", "auth-team", "AUTH-101", `class="ScenarioNotRun"`} {
+		if !strings.Contains(string(index), expected) {
+			t.Fatalf("failed test %s", expected)
+		}
+	}
+
+	t.Run("不正なタグ選択式", func(t *testing.T) {
+		options.TagExpression = "smoke &&"
+		if _, err := New([]Scenario{smoke}, nil, options); err == nil {
+			t.Fatalf("failed test")
+		}
+	})
+}
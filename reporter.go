@@ -0,0 +1,111 @@
+package ettt
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+/*
+DefaultReporters
+既定のReporter.
+HTML（index.html・result.html）、JUnit XML、JSONマニフェスト、コンソールの順に出力する.
+独自のReporterを追加する場合は、戻り値に追加してOptionsのReportersに指定する.
+*/
+func DefaultReporters() []Reporter {
+	return []Reporter{HTMLReporter{}, JUnitReporter{}, ManifestReporter{}, ConsoleReporter{}}
+}
+
+/*
+HTMLReporter
+シナリオ終了時にシナリオ詳細レポート（result.html）、実行終了時に全体レポート（index.html）を出力する.
+*/
+type HTMLReporter struct{}
+
+func (HTMLReporter) OnEvent(gc GlobalContext, event Event) error {
+	switch event.Type {
+	case EventScenarioFinished:
+		// 実行しなかったシナリオは詳細レポートを出力しない
+		if "" == event.Scenario.detailsDir {
+			return nil
+		}
+		return ScenarioReport(gc, event.Scenario)
+	case EventRunFinished:
+		return GlobalReport(gc)
+	}
+	return nil
+}
+
+/*
+JUnitReporter
+実行終了時にJUnit XML（junit.xml）を出力する.
+*/
+type JUnitReporter struct{}
+
+func (JUnitReporter) OnEvent(gc GlobalContext, event Event) error {
+	if EventRunFinished != event.Type {
+		return nil
+	}
+	return JUnitReport(gc)
+}
+
+/*
+ManifestReporter
+実行終了時にJSONマニフェスト（result.json）を出力する.
+*/
+type ManifestReporter struct{}
+
+func (ManifestReporter) OnEvent(gc GlobalContext, event Event) error {
+	if EventRunFinished != event.Type {
+		return nil
+	}
+	return ManifestReport(gc)
+}
+
+/*
+ConsoleReporter
+シナリオ終了毎の結果と、実行終了時の集計をコンソールに出力する.
+Writerが未指定の場合は標準出力に出力する.
+*/
+type ConsoleReporter struct {
+	Writer io.Writer
+}
+
+func (r ConsoleReporter) OnEvent(gc GlobalContext, event Event) error {
+	w := r.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	switch event.Type {
+	case EventScenarioFinished:
+		sc := event.Scenario
+		line := fmt.Sprintf("%-22s %s (%.3fs)", sc.scenarioResultStatus, sc.scenarioName, sc.durationSeconds)
+		if sc.flaky {
+			line += " [flaky]"
+		}
+		switch {
+		case "" != sc.skipReason:
+			line += " : " + sc.skipReason
+		case sc.error != nil:
+			line += " : " + strings.ReplaceAll(sc.error.Error(), "\n", " ")
+		}
+		_, err := fmt.Fprintln(w, Mask(line))
+		return err
+	case EventRunFinished:
+		summary := make(map[ScenarioResultStatus]int)
+		for _, v := range gc.scenarios {
+			summary[v.scenarioResultStatus]++
+		}
+		var counts []string
+		for status, count := range summary {
+			counts = append(counts, fmt.Sprintf("%s: %d", status, count))
+		}
+		sort.Strings(counts)
+		_, err := fmt.Fprintf(w, "%s %d scenarios (%.3fs) %s\nresult : %s\n",
+			gc.ResultStatus(), len(gc.scenarios), gc.end.Sub(gc.start).Seconds(), strings.Join(counts, ", "), gc.executionResultDir)
+		return err
+	}
+	return nil
+}
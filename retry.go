@@ -0,0 +1,182 @@
+package ettt
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+/*
+BackoffStrategy リトライの待機時間の戦略.
+*/
+type BackoffStrategy string
+
+const (
+	// BackoffConstant 毎回Delayだけ待機する
+	BackoffConstant = BackoffStrategy("constant")
+	// BackoffLinear Delay×リトライ回数だけ待機する
+	BackoffLinear = BackoffStrategy("linear")
+	// BackoffExponential Delay×2^(リトライ回数-1)だけ待機する
+	BackoffExponential = BackoffStrategy("exponential")
+)
+
+/*
+RetryPredicate
+リトライするかを判定する関数.
+シナリオの場合、ScenarioFailureはCommandFailure、ScenarioAssertionErrorはCommandAssertionErrorとして判定する.
+*/
+type RetryPredicate func(status CommandResultStatus, err error) bool
+
+/*
+RetryPolicy
+リトライポリシー.
+*/
+type RetryPolicy struct {
+	// 最大試行回数（初回を含む）. 1以下の場合はリトライしない.
+	MaxAttempts int `json:"maxAttempts"`
+	// 初回のリトライまでの待機時間.
+	Delay time.Duration `json:"delay"`
+	// 待機時間の戦略. 未指定の場合はBackoffConstantとなる.
+	Backoff BackoffStrategy `json:"backoff"`
+	// 待機時間の上限. 0以下の場合は上限なし.
+	MaxDelay time.Duration `json:"maxDelay"`
+	// リトライ対象の判定. 未指定の場合は成功以外を全てリトライする.
+	RetryOn RetryPredicate `json:"-"`
+}
+
+/*
+RetryableCommand
+Command単位でリトライポリシーを指定する場合に任意で実装するインタフェース.
+実装していない場合はOptionsのCommandRetryを利用する.
+*/
+type RetryableCommand interface {
+	RetryPolicy() RetryPolicy
+}
+
+/*
+RetryableScenario
+Scenario単位でリトライポリシーを指定する場合に任意で実装するインタフェース.
+実装していない場合はOptionsのScenarioRetryを利用する.
+*/
+type RetryableScenario interface {
+	RetryPolicy() RetryPolicy
+}
+
+/*
+RetryOnStatus
+指定したコマンド結果ステータスの場合にリトライする.
+*/
+func RetryOnStatus(statuses ...CommandResultStatus) RetryPredicate {
+	return func(status CommandResultStatus, err error) bool {
+		for _, s := range statuses {
+			if s == status {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+/*
+RetryOnError
+エラーが指定したエラーのいずれかを含む（errors.Is）場合にリトライする.
+*/
+func RetryOnError(targets ...error) RetryPredicate {
+	return func(status CommandResultStatus, err error) bool {
+		for _, target := range targets {
+			if errors.Is(err, target) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+/*
+shouldRetry
+試行結果からリトライするかを判定.
+*/
+func (p RetryPolicy) shouldRetry(attempt int, status CommandResultStatus, err error) bool {
+	if attempt >= p.MaxAttempts || CommandSuccess == status {
+		return false
+	}
+	if p.RetryOn == nil {
+		return true
+	}
+	return p.RetryOn(status, err)
+}
+
+/*
+delay
+attempt回目の試行後、次の試行までの待機時間.
+*/
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Delay
+	switch p.Backoff {
+	case BackoffLinear:
+		d = p.Delay * time.Duration(attempt)
+	case BackoffExponential:
+		for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+			d *= 2
+		}
+	}
+	if 0 < p.MaxDelay && p.MaxDelay < d {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+/*
+wait
+attempt回目の試行後の待機. コンテキストが終了した場合はエラーを返却する.
+*/
+func (p RetryPolicy) wait(ctx context.Context, attempt int) error {
+	d := p.delay(attempt)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/*
+commandRetryPolicy
+コマンドのリトライポリシーを解決.
+*/
+func commandRetryPolicy(gc GlobalContext, command Command) RetryPolicy {
+	if r, ok := command.(RetryableCommand); ok {
+		return r.RetryPolicy()
+	}
+	return gc.options.CommandRetry
+}
+
+/*
+scenarioRetryPolicy
+シナリオのリトライポリシーを解決.
+*/
+func scenarioRetryPolicy(gc GlobalContext, s Scenario) RetryPolicy {
+	if r, ok := s.(RetryableScenario); ok {
+		return r.RetryPolicy()
+	}
+	return gc.options.ScenarioRetry
+}
+
+/*
+scenarioCommandStatus
+シナリオ結果ステータスをリトライ判定用のコマンド結果ステータスに変換.
+*/
+func scenarioCommandStatus(status ScenarioResultStatus) CommandResultStatus {
+	switch status {
+	case ScenarioFailure:
+		return CommandFailure
+	case ScenarioAssertionError:
+		return CommandAssertionError
+	}
+	return CommandSuccess
+}
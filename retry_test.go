@@ -0,0 +1,213 @@
+package ettt
+
+import (
+	"encoding/xml"
+	"errors"
+	"github.com/google/uuid"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+flakyCommand 指定回数だけ失敗した後に成功するテスト用コマンド.
+*/
+type flakyCommand struct {
+	failures *int
+	status   CommandResultStatus
+	policy   RetryPolicy
+}
+
+func (c flakyCommand) GetId() uuid.UUID {
+	return uuid.Nil
+}
+
+func (c flakyCommand) Execute(gc GlobalContext, sc *ScenarioContext) {
+	if 0 < *c.failures {
+		*c.failures--
+		sc.RegistrationCommandResult(CommandResult{Result: c.status, Message: "503 Service Unavailable"})
+	}
+}
+
+func (c flakyCommand) RetryPolicy() RetryPolicy {
+	return c.policy
+}
+
+/*
+retryScenario リトライポリシーを指定したテスト用シナリオ.
+*/
+type retryScenario struct {
+	funcScenario
+	policy RetryPolicy
+}
+
+func (s retryScenario) RetryPolicy() RetryPolicy {
+	return s.policy
+}
+
+/*
+TestRetryPolicy リトライ判定と待機時間
+*/
+func TestRetryPolicy(t *testing.T) {
+	t.Run("待機時間の戦略", func(t *testing.T) {
+		cases := []struct {
+			policy   RetryPolicy
+			expected []time.Duration
+		}{
+			{RetryPolicy{Delay: time.Second}, []time.Duration{time.Second, time.Second, time.Second}},
+			{RetryPolicy{Delay: time.Second, Backoff: BackoffLinear}, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+			{RetryPolicy{Delay: time.Second, Backoff: BackoffExponential}, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}},
+			{RetryPolicy{Delay: time.Second, Backoff: BackoffExponential, MaxDelay: 3 * time.Second}, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+		}
+		for _, c := range cases {
+			for i, expected := range c.expected {
+				if d := c.policy.delay(i + 1); d != expected {
+					t.Fatalf("failed test %#v attempt=%d delay=%s", c.policy, i+1, d)
+				}
+			}
+		}
+	})
+	t.Run("リトライ判定", func(t *testing.T) {
+		errUnavailable := errors.New("unavailable")
+		policy := RetryPolicy{MaxAttempts: 3}
+		if !policy.shouldRetry(1, CommandAssertionError, nil) || policy.shouldRetry(3, CommandFailure, nil) || policy.shouldRetry(1, CommandSuccess, nil) {
+			t.Fatalf("failed test")
+		}
+		policy.RetryOn = RetryOnStatus(CommandFailure)
+		if policy.shouldRetry(1, CommandAssertionError, nil) || !policy.shouldRetry(1, CommandFailure, nil) {
+			t.Fatalf("failed test")
+		}
+		policy.RetryOn = RetryOnError(errUnavailable)
+		if policy.shouldRetry(1, CommandFailure, errors.New("other")) || !policy.shouldRetry(2, CommandFailure, errors.Join(errors.New("wrapped"), errUnavailable)) {
+			t.Fatalf("failed test")
+		}
+		if (RetryPolicy{}).shouldRetry(1, CommandFailure, nil) {
+			t.Fatalf("failed test")
+		}
+	})
+}
+
+/*
+TestRunRetry コマンド・シナリオのリトライ
+*/
+func TestRunRetry(t *testing.T) {
+	t.Run("コマンドのリトライ後に成功した場合はFlaky", func(t *testing.T) {
+		failures := 2
+		command := flakyCommand{failures: &failures, status: CommandAssertionError, policy: RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond}}
+		engine, err := New([]Scenario{funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+			sc.Run(gc, command)
+			return nil
+		}}}, nil, testOptions(t))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		es := engine.Scenarios()[0]
+		results := es.PhaseResults(ScenarioPhaseExercise)
+		if ScenarioSuccess != es.ResultStatus() || !es.Flaky() || 3 != len(results) {
+			t.Fatalf("failed test status=%s flaky=%t results=%d", es.ResultStatus(), es.Flaky(), len(results))
+		}
+		for i, r := range results {
+			if r.Attempt != i+1 || r.Retried != (i < 2) {
+				t.Fatalf("failed test %#v", r)
+			}
+		}
+
+		bytes, err := os.ReadFile(filepath.Join(engine.ExecutionResultDir(), DefaultJUnitReportPath))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		var suites JUnitTestSuites
+		if err := xml.Unmarshal(bytes, &suites); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if testCase := suites.Suites[0].TestCases[0]; 2 != len(testCase.Flaky) || nil != testCase.Failure {
+			t.Fatalf("failed test %#v", testCase)
+		}
+		index, err := os.ReadFile(filepath.Join(engine.ExecutionResultDir(), DefaultReportTemplateIndexPath))
+		if err != nil || !strings.Contains(string(index), `class="Flaky"`) {
+			t.Fatalf("failed test %#v", err)
+		}
+	})
+	t.Run("リトライ対象外の結果はリトライしない", func(t *testing.T) {
+		failures := 2
+		command := flakyCommand{failures: &failures, status: CommandAssertionError, policy: RetryPolicy{MaxAttempts: 3, RetryOn: RetryOnStatus(CommandFailure)}}
+		sc := &ScenarioContext{phase: ScenarioPhaseExercise}
+		if r := sc.Run(GlobalContext{}, command); CommandAssertionError != r.Result || 1 != len(sc.exercisePhaseResults) {
+			t.Fatalf("failed test %#v", r)
+		}
+	})
+	t.Run("Optionsのリトライポリシー", func(t *testing.T) {
+		failures := 5
+		options := testOptions(t)
+		options.CommandRetry = RetryPolicy{MaxAttempts: 2}
+		sc := &ScenarioContext{phase: ScenarioPhaseVerify}
+		gc := GlobalContext{options: options}
+		// RetryableCommandを実装していても、指定がないポリシーはリトライしない
+		if sc.Run(gc, flakyCommand{failures: &failures, status: CommandFailure}); 1 != len(sc.verifyPhaseResults) {
+			t.Fatalf("failed test %d", len(sc.verifyPhaseResults))
+		}
+		if sc.Run(gc, evidenceCommand{result: CommandFailure}); 3 != len(sc.verifyPhaseResults) {
+			t.Fatalf("failed test %d", len(sc.verifyPhaseResults))
+		}
+		if JudgeScenarioResult(*sc) != ScenarioFailure {
+			t.Fatalf("failed test")
+		}
+	})
+	t.Run("シナリオのリトライ", func(t *testing.T) {
+		attempts := 0
+		var stored []bool
+		scenario := retryScenario{
+			funcScenario: funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+				attempts++
+				_, ok := sc.Store().Get("attempted")
+				stored = append(stored, ok)
+				sc.Store().PutString("attempted", "true")
+				if attempts < 2 {
+					return errors.New("connection reset")
+				}
+				return nil
+			}},
+			policy: RetryPolicy{MaxAttempts: 3, RetryOn: RetryOnStatus(CommandFailure)},
+		}
+		engine, err := New([]Scenario{scenario}, nil, testOptions(t))
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		es := engine.Scenarios()[0]
+		if ScenarioSuccess != es.ResultStatus() || !es.Flaky() || 2 != es.Attempt() || 1 != len(es.Attempts()) || 0 != len(es.PhaseErrors()) {
+			t.Fatalf("failed test status=%s flaky=%t attempt=%d errors=%v", es.ResultStatus(), es.Flaky(), es.Attempt(), es.PhaseErrors())
+		}
+		if a := es.Attempts()[0]; ScenarioFailure != a.Status || !strings.Contains(a.Err.Error(), "connection reset") {
+			t.Fatalf("failed test %#v", a)
+		}
+		// 試行毎にStore変数は破棄される
+		if stored[0] || stored[1] {
+			t.Fatalf("failed test %v", stored)
+		}
+	})
+	t.Run("最大試行回数を超えた場合は失敗", func(t *testing.T) {
+		options := testOptions(t)
+		options.ScenarioRetry = RetryPolicy{MaxAttempts: 2}
+		engine, err := New([]Scenario{funcScenario{exercise: func(gc GlobalContext, sc *ScenarioContext) error {
+			return errors.New("boom")
+		}}}, nil, options)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if err := engine.Run(); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		es := engine.Scenarios()[0]
+		if ScenarioFailure != es.ResultStatus() || es.Flaky() || 2 != es.Attempt() || 1 != len(es.PhaseErrors()) {
+			t.Fatalf("failed test status=%s flaky=%t attempt=%d", es.ResultStatus(), es.Flaky(), es.Attempt())
+		}
+	})
+}
@@ -1,8 +1,18 @@
 package ettt
 
+import (
+	"context"
+	"time"
+)
+
 /*
 Scenario
 シナリオインタフェース
+
+各Phaseはキャンセル可能なコンテキスト（sc.Context()）で実行され、Phase毎に *ScenarioContext の複製が渡される.
+Store変数・クリーンアップ・コマンド実行結果はPhaseの終了時に元のシナリオコンテキストへ反映されるため、
+Phase間で受け渡す値はStore変数に保持し、*ScenarioContext のポインタを保持して後のPhaseで利用しないこと.
+タイムアウト後の猶予期間内に終了しなかったPhaseの更新は反映されない.
 */
 type Scenario interface {
 	/*
@@ -26,3 +36,114 @@ type Scenario interface {
 	*/
 	TearDown(gc GlobalContext, context *ScenarioContext) error
 }
+
+/*
+ContextScenario
+Phaseのコンテキストを引数で受け取るシナリオが任意で実装するインタフェース.
+実装している場合は、Scenarioの各Phaseの代わりに呼び出す.
+ctxはsc.Context()と同じで、タイムアウト・実行全体のキャンセルで完了する.
+*/
+type ContextScenario interface {
+	Scenario
+	SetupContext(ctx context.Context, gc GlobalContext, sc *ScenarioContext) error
+	ExerciseContext(ctx context.Context, gc GlobalContext, sc *ScenarioContext) error
+	VerifyContext(ctx context.Context, gc GlobalContext, sc *ScenarioContext) error
+	TearDownContext(ctx context.Context, gc GlobalContext, sc *ScenarioContext) error
+}
+
+/*
+ExclusiveScenario
+並列実行時に排他制御が必要なシナリオが任意で実装するインタフェース.
+同一の排他グループ名を返すシナリオ同士は同時に実行されない.
+*/
+type ExclusiveScenario interface {
+	/*
+		ExclusiveGroup
+		排他グループ名.
+		空文字の場合は排他制御を行わない.
+	*/
+	ExclusiveGroup() string
+}
+
+/*
+TimeoutScenario
+Phase毎のタイムアウトをシナリオ単位で指定する場合に任意で実装するインタフェース.
+*/
+type TimeoutScenario interface {
+	/*
+		PhaseTimeout
+		Phaseのタイムアウト.
+		0以下の場合はOptionsのPhaseTimeoutを利用する.
+	*/
+	PhaseTimeout(phase ScenarioPhase) time.Duration
+}
+
+/*
+MetadataScenario
+シナリオのメタデータを指定する場合に任意で実装するインタフェース.
+メタデータは全てのレポートに出力され、タグはOptionsのTagExpressionによる選択に利用される.
+*/
+type MetadataScenario interface {
+	/*
+		Metadata
+		シナリオのメタデータ.
+	*/
+	Metadata() ScenarioMetadata
+}
+
+/*
+ScenarioMetadata
+シナリオのメタデータ.
+*/
+type ScenarioMetadata struct {
+	// 表示名. Newで生成した場合は型名の代わりにシナリオ名として利用する.
+	DisplayName string `json:"displayName,omitempty"`
+	// 説明
+	Description string `json:"description,omitempty"`
+	// タグ
+	Tags []string `json:"tags,omitempty"`
+	// 担当者
+	Owner string `json:"owner,omitempty"`
+	// 優先度（high, P1 など）
+	Priority string `json:"priority,omitempty"`
+	// 関連するチケットID
+	Tickets []string `json:"tickets,omitempty"`
+}
+
+/*
+scenarioMetadata
+シナリオのメタデータを取得.
+MetadataScenarioを実装していない場合は空.
+*/
+func scenarioMetadata(s Scenario) ScenarioMetadata {
+	if m, ok := s.(MetadataScenario); ok {
+		return m.Metadata()
+	}
+	return ScenarioMetadata{}
+}
+
+/*
+DependentScenario
+他のシナリオの成功を前提とするシナリオが任意で実装するインタフェース.
+前提シナリオの完了後に実行され、前提シナリオが成功しなかった場合は実行せずにScenarioSkippedとなる.
+*/
+type DependentScenario interface {
+	/*
+		DependsOn
+		前提とするシナリオ名.
+		データ駆動シナリオの場合は全てのデータ行が前提となる.
+	*/
+	DependsOn() []string
+}
+
+/*
+scenarioDependencies
+シナリオが前提とするシナリオ名を取得.
+DependentScenarioを実装していない場合は空.
+*/
+func scenarioDependencies(s Scenario) []string {
+	if d, ok := s.(DependentScenario); ok {
+		return d.DependsOn()
+	}
+	return nil
+}
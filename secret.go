@@ -0,0 +1,436 @@
+package ettt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// SecretMask 秘匿値の置換文字列.
+	SecretMask string = "********"
+	// SecretEncryptedPrefix 暗号化されたProfile変数値の接頭辞.
+	SecretEncryptedPrefix string = "enc:"
+	// SecretKeyFileEnv 暗号化キーファイルのパスを指定する環境変数.
+	SecretKeyFileEnv string = "ETTT_SECRET_KEY_FILE"
+)
+
+/*
+Profile変数値中の外部参照を抽出する正規表現.
+${env:環境変数名} と ${file:ファイルパス} に対応する.
+*/
+var secretReferenceRe = regexp.MustCompile(`\$\{(env|file):([^\}]+)\}`)
+
+/*
+masker
+登録された秘匿値をマスクする.
+*/
+type masker struct {
+	mu       sync.RWMutex
+	secrets  map[string]bool
+	replacer *strings.Replacer
+}
+
+var defaultMasker = &masker{secrets: make(map[string]bool)}
+
+/*
+RegisterSecret
+秘匿値を登録する.
+登録された値はログ、コマンド結果、レポート、テキストのエビデンスからマスクされる.
+*/
+func RegisterSecret(value string) {
+	if "" == value {
+		return
+	}
+	defaultMasker.mu.Lock()
+	defer defaultMasker.mu.Unlock()
+	if defaultMasker.secrets[value] {
+		return
+	}
+	defaultMasker.secrets[value] = true
+	// 部分一致する秘匿値があっても全体をマスクできるように、長い値から置換する
+	values := make([]string, 0, len(defaultMasker.secrets))
+	for v := range defaultMasker.secrets {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	pairs := make([]string, 0, len(values)*2)
+	for _, v := range values {
+		pairs = append(pairs, v, SecretMask)
+	}
+	defaultMasker.replacer = strings.NewReplacer(pairs...)
+}
+
+/*
+Mask
+文字列中の秘匿値をマスクする.
+*/
+func Mask(s string) string {
+	defaultMasker.mu.RLock()
+	defer defaultMasker.mu.RUnlock()
+	if defaultMasker.replacer == nil {
+		return s
+	}
+	return defaultMasker.replacer.Replace(s)
+}
+
+/*
+maskedError
+メッセージ中の秘匿値をマスクしたエラー.
+errors.Is / errors.As は元のエラーに対して行える.
+*/
+type maskedError struct {
+	err error
+}
+
+func (e *maskedError) Error() string {
+	return Mask(e.err.Error())
+}
+
+func (e *maskedError) Unwrap() error {
+	return e.err
+}
+
+/*
+maskError
+エラーメッセージをマスクするエラーでラップする.
+*/
+func maskError(err error) error {
+	var masked *maskedError
+	if err == nil || errors.As(err, &masked) {
+		return err
+	}
+	return &maskedError{err: err}
+}
+
+/*
+maskCommandResult
+コマンド結果のメッセージ・エラー・パラメータをマスクする.
+*/
+func maskCommandResult(r CommandResult) CommandResult {
+	r.Message = Mask(r.Message)
+	r.Error = maskError(r.Error)
+	if r.Parameters != nil {
+		parameters := make(map[string]string, len(r.Parameters))
+		for k, v := range r.Parameters {
+			parameters[k] = Mask(v)
+		}
+		r.Parameters = parameters
+	}
+	if r.Observations != nil {
+		observations := make([]Observation, 0, len(r.Observations))
+		for _, o := range r.Observations {
+			o.Message = Mask(o.Message)
+			o.Error = maskError(o.Error)
+			observations = append(observations, o)
+		}
+		r.Observations = observations
+	}
+	return r
+}
+
+/*
+maskedProfileVariables
+レポート出力用に秘匿値をマスクしたProfile変数.
+*/
+func maskedProfileVariables(profile Profile) []ProfileVariable {
+	variables := make([]ProfileVariable, 0, len(profile.Variables))
+	for _, v := range profile.Variables {
+		if v.Secret {
+			v.Value = SecretMask
+		}
+		variables = append(variables, v)
+	}
+	return variables
+}
+
+/*
+MaskingHandler
+ログのメッセージと属性値から秘匿値をマスクするslog.Handler.
+*/
+type MaskingHandler struct {
+	handler slog.Handler
+}
+
+/*
+NewMaskingHandler
+指定したハンドラをラップしたMaskingHandlerを生成.
+*/
+func NewMaskingHandler(handler slog.Handler) *MaskingHandler {
+	return &MaskingHandler{handler: handler}
+}
+
+func (h *MaskingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *MaskingHandler) Handle(ctx context.Context, record slog.Record) error {
+	masked := slog.NewRecord(record.Time, record.Level, Mask(record.Message), record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		masked.AddAttrs(maskAttr(a))
+		return true
+	})
+	return h.handler.Handle(ctx, masked)
+}
+
+func (h *MaskingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		masked = append(masked, maskAttr(a))
+	}
+	return &MaskingHandler{handler: h.handler.WithAttrs(masked)}
+}
+
+func (h *MaskingHandler) WithGroup(name string) slog.Handler {
+	return &MaskingHandler{handler: h.handler.WithGroup(name)}
+}
+
+func maskAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Mask(v.String()))
+	case slog.KindGroup:
+		attrs := v.Group()
+		masked := make([]any, 0, len(attrs))
+		for _, g := range attrs {
+			masked = append(masked, maskAttr(g))
+		}
+		return slog.Group(a.Key, masked...)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, Mask(err.Error()))
+		}
+		return slog.String(a.Key, Mask(fmt.Sprint(v.Any())))
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+/*
+stdlibDefaultHandler
+パッケージ初期化時点のslogのデフォルトハンドラ（logパッケージへ出力するハンドラ）.
+*/
+var stdlibDefaultHandler = slog.Default().Handler()
+
+/*
+installMaskingHandler
+デフォルトのロガーのハンドラをMaskingHandlerでラップする.
+既にラップ済みの場合は何もしない.
+利用側が設定したハンドラはレベル・書式・属性を維持したままラップする.
+*/
+func installMaskingHandler() {
+	handler := slog.Default().Handler()
+	if _, ok := handler.(*MaskingHandler); ok {
+		return
+	}
+	if handler == stdlibDefaultHandler {
+		// slogのデフォルトハンドラはlogパッケージへ出力するため、そのままラップすると
+		// SetDefault後にlog→slog→logの循環となる. logパッケージと同じ出力先・書式のロガーを経由する.
+		logger := log.New(log.Writer(), log.Prefix(), log.Flags())
+		handler = slog.NewTextHandler(logWriter{logger}, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if 0 == len(groups) && slog.TimeKey == a.Key {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})
+	}
+	slog.SetDefault(slog.New(NewMaskingHandler(handler)))
+}
+
+/*
+logWriter
+1レコード毎に*log.Loggerへ出力するio.Writer.
+*/
+type logWriter struct {
+	logger *log.Logger
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	if err := w.logger.Output(2, strings.TrimSuffix(string(p), "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+/*
+resolveSecrets
+Profile変数の外部参照・暗号化値を解決し、秘匿値を登録する.
+外部参照（${env:...}, ${file:...}）と暗号化値を含む変数は秘匿値として扱う.
+*/
+func resolveSecrets(options Options, profile *Profile) error {
+	var key []byte
+	for i, v := range profile.Variables {
+		if v.Data != nil {
+			// 構造化された値は外部参照・暗号化の対象外. 秘匿値の場合は全ての文字列の値とJSON文字列をマスク対象とする
+			if v.Secret {
+				registerSecretData(v.Data)
+				RegisterSecret(v.Value)
+			}
+			continue
+		}
+		value := v.Value
+		if strings.HasPrefix(value, SecretEncryptedPrefix) {
+			if key == nil {
+				var err error
+				if key, err = loadSecretKey(options); err != nil {
+					return fmt.Errorf("can not decrypt profile variable %s. %w", v.Key, err)
+				}
+			}
+			plain, err := DecryptSecret(key, strings.TrimPrefix(value, SecretEncryptedPrefix))
+			if err != nil {
+				return fmt.Errorf("can not decrypt profile variable %s. %w", v.Key, err)
+			}
+			value = plain
+			profile.Variables[i].Secret = true
+		}
+		var resolveErr error
+		value = secretReferenceRe.ReplaceAllStringFunc(value, func(ref string) string {
+			m := secretReferenceRe.FindStringSubmatch(ref)
+			profile.Variables[i].Secret = true
+			switch m[1] {
+			case "env":
+				env, ok := os.LookupEnv(m[2])
+				if !ok {
+					resolveErr = fmt.Errorf("environment variable %s is not set. profile variable : %s", m[2], v.Key)
+				}
+				return env
+			default:
+				b, err := os.ReadFile(m[2])
+				if err != nil {
+					resolveErr = fmt.Errorf("can not read secret file. profile variable : %s. %w", v.Key, err)
+				}
+				return strings.TrimRight(string(b), "\r\n")
+			}
+		})
+		if resolveErr != nil {
+			return resolveErr
+		}
+		profile.Variables[i].Value = value
+		if profile.Variables[i].Secret {
+			RegisterSecret(value)
+		}
+	}
+	return nil
+}
+
+/*
+registerSecretData
+構造化された値に含まれる全ての文字列の値を秘匿値として登録する.
+*/
+func registerSecretData(data any) {
+	switch v := data.(type) {
+	case string:
+		RegisterSecret(v)
+	case map[string]any:
+		for _, e := range v {
+			registerSecretData(e)
+		}
+	case []any:
+		for _, e := range v {
+			registerSecretData(e)
+		}
+	}
+}
+
+/*
+loadSecretKey
+暗号化キーを読み込む.
+キーファイルにはBase64でエンコードした32バイト（AES-256）のキーを記載する.
+*/
+func loadSecretKey(options Options) ([]byte, error) {
+	path := options.SecretKeyFile
+	if "" == path {
+		path = os.Getenv(SecretKeyFileEnv)
+	}
+	if "" == path {
+		return nil, errors.New("secret key file is not specified")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("secret key file is not base64. %w", err)
+	}
+	if 32 != len(key) {
+		return nil, fmt.Errorf("secret key must be 32 bytes. actual : %d", len(key))
+	}
+	return key, nil
+}
+
+/*
+GenerateSecretKey
+Base64でエンコードした暗号化キーを生成する.
+*/
+func GenerateSecretKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+/*
+EncryptSecret
+AES-GCMで暗号化し、Profileに記載する形式（enc:Base64）で返却する.
+*/
+func EncryptSecret(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return SecretEncryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+/*
+DecryptSecret
+EncryptSecretで暗号化した値（接頭辞なしのBase64）を復号する.
+*/
+func DecryptSecret(key []byte, ciphertext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,153 @@
+package ettt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+TestSecret 秘匿値の解決とマスク
+*/
+func TestSecret(t *testing.T) {
+	t.Run("暗号化と復号", func(t *testing.T) {
+		encoded, err := GenerateSecretKey()
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		key, _ := base64.StdEncoding.DecodeString(encoded)
+		encrypted, err := EncryptSecret(key, "p@ssw0rd")
+		if err != nil || !strings.HasPrefix(encrypted, SecretEncryptedPrefix) {
+			t.Fatalf("failed test %#v %#v", encrypted, err)
+		}
+		plain, err := DecryptSecret(key, strings.TrimPrefix(encrypted, SecretEncryptedPrefix))
+		if err != nil || plain != "p@ssw0rd" {
+			t.Fatalf("failed test %#v %#v", plain, err)
+		}
+	})
+
+	t.Run("外部参照と暗号化値の解決", func(t *testing.T) {
+		dir := t.TempDir()
+		encoded, _ := GenerateSecretKey()
+		keyFile := filepath.Join(dir, "secret.key")
+		if err := os.WriteFile(keyFile, []byte(encoded+"\n"), 0o600); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		key, _ := base64.StdEncoding.DecodeString(encoded)
+		encrypted, _ := EncryptSecret(key, "encrypted-secret-value")
+		tokenFile := filepath.Join(dir, "token")
+		if err := os.WriteFile(tokenFile, []byte("file-secret-value\n"), 0o600); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		t.Setenv("ETTT_TEST_SECRET", "env-secret-value")
+
+		profile := Profile{Variables: []ProfileVariable{
+			{Key: "plain", Value: "visible"},
+			{Key: "env", Value: "${env:ETTT_TEST_SECRET}"},
+			{Key: "file", Value: "${file:" + tokenFile + "}"},
+			{Key: "enc", Value: encrypted},
+		}}
+		if err := resolveSecrets(Options{SecretKeyFile: keyFile}, &profile); err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		expected := map[string]string{
+			"plain": "visible",
+			"env":   "env-secret-value",
+			"file":  "file-secret-value",
+			"enc":   "encrypted-secret-value",
+		}
+		for _, v := range profile.Variables {
+			if expected[v.Key] != v.Value || v.Secret == ("plain" == v.Key) {
+				t.Fatalf("failed test %#v", v)
+			}
+		}
+		masked := Mask("token=env-secret-value, key=encrypted-secret-value, visible")
+		if masked != "token="+SecretMask+", key="+SecretMask+", visible" {
+			t.Fatalf("failed test %#v", masked)
+		}
+		for _, v := range maskedProfileVariables(profile) {
+			if v.Secret && SecretMask != v.Value {
+				t.Fatalf("failed test %#v", v)
+			}
+		}
+	})
+
+	t.Run("未設定の環境変数はエラー", func(t *testing.T) {
+		profile := Profile{Variables: []ProfileVariable{{Key: "env", Value: "${env:ETTT_TEST_UNDEFINED}"}}}
+		if err := resolveSecrets(Options{}, &profile); err == nil {
+			t.Fatalf("failed test %#v", profile)
+		}
+	})
+
+	t.Run("構造化された秘匿値は全ての文字列の値をマスク", func(t *testing.T) {
+		dir := writeProfiles(t, map[string]string{
+			"default": `name: default
+variables:
+  - key: db
+    secret: true
+    value:
+      host: db.secret.local
+      password: structured-secret-password
+      replicas: [replica-secret-1]
+`,
+		})
+		profile, err := LoadProfile(Options{ProfilePath: dir})
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		password, err := profile.GetString("db.password")
+		if err != nil || "structured-secret-password" != password {
+			t.Fatalf("failed test %#v %#v", password, err)
+		}
+		v, _ := profile.Get("db")
+		masked := Mask("pw=" + password + " replica=replica-secret-1 json=" + v.Value)
+		if "pw="+SecretMask+" replica="+SecretMask+" json="+SecretMask != masked {
+			t.Fatalf("failed test %s", masked)
+		}
+	})
+	t.Run("エラーとコマンド結果のマスク", func(t *testing.T) {
+		RegisterSecret("masked-in-error")
+		cause := errors.New("login failed. password : masked-in-error")
+		err := maskError(cause)
+		if strings.Contains(err.Error(), "masked-in-error") || !errors.Is(err, cause) {
+			t.Fatalf("failed test %#v", err.Error())
+		}
+		result := maskCommandResult(CommandResult{
+			Message:    "masked-in-error",
+			Parameters: map[string]string{"password": "masked-in-error"},
+		})
+		if SecretMask != result.Message || SecretMask != result.Parameters["password"] {
+			t.Fatalf("failed test %#v", result)
+		}
+	})
+
+	t.Run("利用側のハンドラを維持してマスクする", func(t *testing.T) {
+		installMaskingHandler()
+		original := slog.Default()
+		t.Cleanup(func() {
+			slog.SetDefault(original)
+		})
+		RegisterSecret("masked-in-host-log")
+		var buf bytes.Buffer
+		slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})).With("app", "host"))
+		installMaskingHandler()
+		if _, ok := slog.Default().Handler().(*MaskingHandler); !ok {
+			t.Fatalf("failed test %#v", slog.Default().Handler())
+		}
+		slog.Info("ignored")
+		slog.Warn("login", "password", "masked-in-host-log")
+		var record map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+			t.Fatalf("failed test %#v %s", err, buf.String())
+		}
+		if "login" != record["msg"] || "host" != record["app"] || SecretMask != record["password"] {
+			t.Fatalf("failed test %s", buf.String())
+		}
+	})
+}
@@ -0,0 +1,323 @@
+package ettt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+/*
+VariableType Store変数の型.
+*/
+type VariableType string
+
+const (
+	VariableTypeString = VariableType("string")
+	VariableTypeNumber = VariableType("number")
+	VariableTypeBool   = VariableType("bool")
+	VariableTypeJSON   = VariableType("json")
+)
+
+/*
+Variable
+型付きのStore変数.
+JSON型の値は encoding/json でデコードした形式（map[string]any, []any など）で保持する.
+*/
+type Variable struct {
+	Type  VariableType
+	Value any
+}
+
+/*
+String
+変数を文字列に変換.
+変数置換（Replace）時はこの文字列が利用される.
+*/
+func (v Variable) String() string {
+	switch v.Type {
+	case VariableTypeString:
+		return v.Value.(string)
+	case VariableTypeNumber:
+		return strconv.FormatFloat(v.Value.(float64), 'f', -1, 64)
+	case VariableTypeBool:
+		return strconv.FormatBool(v.Value.(bool))
+	default:
+		b, err := json.Marshal(v.Value)
+		if err != nil {
+			return fmt.Sprint(v.Value)
+		}
+		return string(b)
+	}
+}
+
+/*
+StoreVariables
+ストア変数.
+複数のシナリオから同時に参照・更新されても安全に扱える.
+*/
+type StoreVariables struct {
+	mu        sync.RWMutex
+	variables map[string]Variable
+}
+
+/*
+NewStoreVariables
+空のストア変数を生成.
+*/
+func NewStoreVariables() *StoreVariables {
+	return &StoreVariables{variables: make(map[string]Variable)}
+}
+
+/*
+Store
+シナリオ内で有効なStore変数を取得.
+*/
+func (sc *ScenarioContext) Store() *StoreVariables {
+	if sc.store == nil {
+		sc.store = NewStoreVariables()
+	}
+	return sc.store
+}
+
+/*
+GlobalStore
+シナリオ間で共有するGlobal変数を取得.
+先行するシナリオで保存した値（ログイントークンなど）を後続のシナリオへ引き継ぐ場合に利用する.
+*/
+func (gc GlobalContext) GlobalStore() *StoreVariables {
+	if gc.globalStore == nil {
+		// Newを経由していない場合は参照のみ可能な空のストアとなる
+		return NewStoreVariables()
+	}
+	return gc.globalStore
+}
+
+/*
+Put
+値の型を判定して変数を保存する.
+文字列・数値・真偽値以外はJSON型として保存する.
+*/
+func (s *StoreVariables) Put(name string, value any) error {
+	switch v := value.(type) {
+	case string:
+		s.PutString(name, v)
+		return nil
+	case bool:
+		s.PutBool(name, v)
+		return nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		s.PutNumber(name, f)
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.PutNumber(name, float64(rv.Int()))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s.PutNumber(name, float64(rv.Uint()))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		s.PutNumber(name, rv.Float())
+		return nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("can not store variable %s. %w", name, err)
+	}
+	return s.PutJSON(name, b)
+}
+
+/*
+PutString
+文字列型の変数を保存.
+*/
+func (s *StoreVariables) PutString(name string, value string) {
+	s.set(name, Variable{Type: VariableTypeString, Value: value})
+}
+
+/*
+PutNumber
+数値型の変数を保存.
+*/
+func (s *StoreVariables) PutNumber(name string, value float64) {
+	s.set(name, Variable{Type: VariableTypeNumber, Value: value})
+}
+
+/*
+PutBool
+真偽値型の変数を保存.
+*/
+func (s *StoreVariables) PutBool(name string, value bool) {
+	s.set(name, Variable{Type: VariableTypeBool, Value: value})
+}
+
+/*
+PutJSON
+JSON文字列を解析してJSON型の変数を保存.
+*/
+func (s *StoreVariables) PutJSON(name string, value []byte) error {
+	var v any
+	if err := json.Unmarshal(value, &v); err != nil {
+		return fmt.Errorf("can not store variable %s. invalid json. %w", name, err)
+	}
+	s.set(name, Variable{Type: VariableTypeJSON, Value: v})
+	return nil
+}
+
+/*
+Get
+変数を取得.
+*/
+func (s *StoreVariables) Get(name string) (Variable, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.variables[name]
+	return v, ok
+}
+
+/*
+GetString
+変数を文字列として取得.
+文字列型以外の場合は Variable.String で変換した値となる.
+*/
+func (s *StoreVariables) GetString(name string) (string, bool) {
+	v, ok := s.Get(name)
+	if !ok {
+		return "", false
+	}
+	return v.String(), true
+}
+
+/*
+GetNumber
+変数を数値として取得.
+文字列型の場合は数値として解析できれば変換する.
+*/
+func (s *StoreVariables) GetNumber(name string) (float64, error) {
+	v, ok := s.Get(name)
+	if !ok {
+		return 0, fmt.Errorf("variable %s not found", name)
+	}
+	switch v.Type {
+	case VariableTypeNumber:
+		return v.Value.(float64), nil
+	case VariableTypeString:
+		return strconv.ParseFloat(v.Value.(string), 64)
+	}
+	return 0, fmt.Errorf("variable %s is not number. type : %s", name, v.Type)
+}
+
+/*
+GetBool
+変数を真偽値として取得.
+文字列型の場合は真偽値として解析できれば変換する.
+*/
+func (s *StoreVariables) GetBool(name string) (bool, error) {
+	v, ok := s.Get(name)
+	if !ok {
+		return false, fmt.Errorf("variable %s not found", name)
+	}
+	switch v.Type {
+	case VariableTypeBool:
+		return v.Value.(bool), nil
+	case VariableTypeString:
+		return strconv.ParseBool(v.Value.(string))
+	}
+	return false, fmt.Errorf("variable %s is not bool. type : %s", name, v.Type)
+}
+
+/*
+GetJSON
+変数をJSONとして指定した構造体に変換して取得.
+*/
+func (s *StoreVariables) GetJSON(name string, out any) error {
+	v, ok := s.Get(name)
+	if !ok {
+		return fmt.Errorf("variable %s not found", name)
+	}
+	b, err := json.Marshal(v.Value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+/*
+Lookup
+変数パス（response.items[0].id など）で値を取得.
+JSON型の変数は入れ子の値を参照できる.
+*/
+func (s *StoreVariables) Lookup(path string) (any, error) {
+	segments, err := parseVariablePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.lookup(segments)
+}
+
+func (s *StoreVariables) lookup(segments []variablePathSegment) (any, error) {
+	if segments[0].isIndex {
+		return nil, fmt.Errorf("variable path must start with key")
+	}
+	v, ok := s.Get(segments[0].key)
+	if !ok {
+		return nil, fmt.Errorf("variable %s not found", segments[0].key)
+	}
+	return lookupVariablePath(v.Value, segments[1:])
+}
+
+/*
+Delete
+変数を削除.
+*/
+func (s *StoreVariables) Delete(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.variables, name)
+}
+
+/*
+Names
+保存されている変数名を名前順で取得.
+*/
+func (s *StoreVariables) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.variables))
+	for k := range s.variables {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+clone
+変数を複製したストアを生成.
+*/
+func (s *StoreVariables) clone() *StoreVariables {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c := NewStoreVariables()
+	for k, v := range s.variables {
+		c.variables[k] = v
+	}
+	return c
+}
+
+func (s *StoreVariables) set(name string, v Variable) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.variables == nil {
+		s.variables = make(map[string]Variable)
+	}
+	s.variables[name] = v
+}
@@ -0,0 +1,58 @@
+package ettt
+
+import (
+	"sync"
+	"testing"
+)
+
+/*
+TestStoreVariables 型付きStore変数の保存と取得
+*/
+func TestStoreVariables(t *testing.T) {
+	t.Run("型の判定と変換", func(t *testing.T) {
+		s := NewStoreVariables()
+		s.Put("s", "text")
+		s.Put("i", 42)
+		s.Put("b", false)
+		s.Put("j", []string{"a", "b"})
+		s.PutString("n", "1.5")
+
+		if v, _ := s.Get("i"); v.Type != VariableTypeNumber || v.String() != "42" {
+			t.Fatalf("failed test %#v", v)
+		}
+		if v, _ := s.Get("j"); v.Type != VariableTypeJSON || v.String() != `["a","b"]` {
+			t.Fatalf("failed test %#v", v)
+		}
+		if n, err := s.GetNumber("n"); err != nil || n != 1.5 {
+			t.Fatalf("failed test %v %#v", n, err)
+		}
+		if _, err := s.GetBool("j"); err == nil {
+			t.Fatal("failed test")
+		}
+		var list []string
+		if err := s.GetJSON("j", &list); err != nil || len(list) != 2 {
+			t.Fatalf("failed test %v %#v", list, err)
+		}
+		s.Delete("s")
+		if names := s.Names(); len(names) != 4 || names[0] != "b" {
+			t.Fatalf("failed test %v", names)
+		}
+	})
+	t.Run("並行アクセス", func(t *testing.T) {
+		s := NewStoreVariables()
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				s.Put("count", i)
+				s.GetString("count")
+				s.Names()
+			}(i)
+		}
+		wg.Wait()
+		if _, ok := s.Get("count"); !ok {
+			t.Fatal("failed test")
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package ettt
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+TagExpression
+シナリオのタグに対する選択式.
+
+	smoke              smokeタグを持つ
+	!slow              slowタグを持たない
+	smoke && !slow     かつ
+	api || ui          または
+	(api || ui) && smoke
+
+演算子の優先度は ! > && > || となる.
+*/
+type TagExpression struct {
+	root *tagNode
+}
+
+/*
+tagNode
+タグ選択式の構文木.
+*/
+type tagNode struct {
+	// tag / not / and / or
+	op       string
+	tag      string
+	children []*tagNode
+}
+
+/*
+ParseTagExpression
+タグ選択式を解析.
+空文字の場合は全てのシナリオを選択する式となる.
+*/
+func ParseTagExpression(expression string) (TagExpression, error) {
+	p := &tagParser{src: expression}
+	p.skipSpaces()
+	if p.eof() {
+		return TagExpression{}, nil
+	}
+	root, err := p.parseOr()
+	if err == nil && !p.eof() {
+		err = fmt.Errorf("unexpected character %q at %d", p.src[p.pos], p.pos)
+	}
+	if err != nil {
+		return TagExpression{}, fmt.Errorf("invalid tag expression. expression : %s. %w", expression, err)
+	}
+	return TagExpression{root: root}, nil
+}
+
+/*
+Match
+タグが選択式を満たすか判定.
+*/
+func (e TagExpression) Match(tags []string) bool {
+	if e.root == nil {
+		return true
+	}
+	set := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		set[t] = true
+	}
+	return e.root.match(set)
+}
+
+func (n *tagNode) match(tags map[string]bool) bool {
+	switch n.op {
+	case "not":
+		return !n.children[0].match(tags)
+	case "and":
+		for _, c := range n.children {
+			if !c.match(tags) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, c := range n.children {
+			if c.match(tags) {
+				return true
+			}
+		}
+		return false
+	}
+	return tags[n.tag]
+}
+
+/*
+tagParser
+タグ選択式の解析器.
+*/
+type tagParser struct {
+	src string
+	pos int
+}
+
+func (p *tagParser) parseOr() (*tagNode, error) {
+	return p.parseBinary("||", "or", p.parseAnd)
+}
+
+func (p *tagParser) parseAnd() (*tagNode, error) {
+	return p.parseBinary("&&", "and", p.parseUnary)
+}
+
+/*
+parseBinary
+演算子で区切られた式を解析.
+*/
+func (p *tagParser) parseBinary(operator string, op string, operand func() (*tagNode, error)) (*tagNode, error) {
+	n, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	node := &tagNode{op: op, children: []*tagNode{n}}
+	for p.skipSpaces(); strings.HasPrefix(p.src[p.pos:], operator); p.skipSpaces() {
+		p.pos += len(operator)
+		if n, err = operand(); err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, n)
+	}
+	if 1 == len(node.children) {
+		return node.children[0], nil
+	}
+	return node, nil
+}
+
+func (p *tagParser) parseUnary() (*tagNode, error) {
+	p.skipSpaces()
+	if p.eof() {
+		return nil, fmt.Errorf("tag is required at %d", p.pos)
+	}
+	switch p.src[p.pos] {
+	case '!':
+		p.pos++
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &tagNode{op: "not", children: []*tagNode{n}}, nil
+	case '(':
+		p.pos++
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.skipSpaces(); p.eof() || ')' != p.src[p.pos] {
+			return nil, fmt.Errorf("unclosed parenthesis at %d", p.pos)
+		}
+		p.pos++
+		return n, nil
+	}
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n!&|()", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, fmt.Errorf("unexpected character %q at %d", p.src[p.pos], p.pos)
+	}
+	return &tagNode{op: "tag", tag: p.src[start:p.pos]}, nil
+}
+
+func (p *tagParser) skipSpaces() {
+	for !p.eof() && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *tagParser) eof() bool {
+	return p.pos >= len(p.src)
+}
@@ -0,0 +1,45 @@
+package ettt
+
+import (
+	"testing"
+)
+
+/*
+TestTagExpression タグ選択式の解析と判定
+*/
+func TestTagExpression(t *testing.T) {
+	t.Run("判定", func(t *testing.T) {
+		cases := []struct {
+			expression string
+			tags       []string
+			expected   bool
+		}{
+			{"", nil, true},
+			{"smoke", []string{"smoke"}, true},
+			{"smoke", []string{"api"}, false},
+			{"smoke && !slow", []string{"smoke"}, true},
+			{"smoke && !slow", []string{"smoke", "slow"}, false},
+			{"api || ui && smoke", []string{"api"}, true},
+			{"(api || ui) && smoke", []string{"api"}, false},
+			{"(api || ui) && smoke", []string{"ui", "smoke"}, true},
+			{"!!smoke", []string{"smoke"}, true},
+			{"team:payment&&p1", []string{"team:payment", "p1"}, true},
+		}
+		for _, c := range cases {
+			e, err := ParseTagExpression(c.expression)
+			if err != nil {
+				t.Fatalf("failed test %#v", err)
+			}
+			if e.Match(c.tags) != c.expected {
+				t.Fatalf("failed test %s %v", c.expression, c.tags)
+			}
+		}
+	})
+	t.Run("不正な選択式", func(t *testing.T) {
+		for _, expression := range []string{"smoke &&", "!", "(smoke", "smoke)", "smoke & slow", "smoke slow", "|| smoke"} {
+			if _, err := ParseTagExpression(expression); err == nil {
+				t.Fatalf("failed test %s", expression)
+			}
+		}
+	})
+}
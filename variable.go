@@ -3,74 +3,326 @@ package ettt
 import (
 	"fmt"
 	"log/slog"
-	"regexp"
 	"strings"
 )
 
-/*
-変数を抽出する正規表現.
-*/
-var re = regexp.MustCompile(`\$\{([^\}]+)\}`)
-
 /*
 Resolve 変数を解決.
 スコープ指定がされている場合は、該当スコープのみを走査して解決
-スコープ指定がされていない場合に、Profile＞Storeの順序で走査を行い解決
+スコープ指定がされていない場合に、Profile＞Store＞Global＞Dataの順序で走査を行い解決
+変数名の後に続けてパスを指定すると、入れ子の値を参照できる（例 : profile.users[1].name）.
+関数・デフォルト値・フィルタを含む変数式も評価する（Evaluate参照）.
+スカラー値は文字列に、Map・リストはJSON文字列に変換する.
 */
 func Resolve(gc GlobalContext, sc ScenarioContext, target string) (string, error) {
-	targetArray := strings.Split(target, VariableScopeSeparator)
-	if 1 == len(targetArray) {
-		slog.Debug("epion-t3: try resolve from all scope variable.", "target", target)
-		for _, v := range gc.profile.Variables {
-			if v.Key == targetArray[0] {
-				return v.Value, nil
-			}
-		}
-		for k, v := range sc.Store.Variables {
-			if k == targetArray[0] {
-				return v, nil
-			}
-		}
-	} else if 2 == len(targetArray) {
-		slog.Debug("epion-t3: try resolve scope variable.", "scope", targetArray[0], "target", targetArray[1])
-		if ScopeNameProfile == targetArray[0] {
+	v, err := Evaluate(gc, sc, target)
+	if err != nil {
+		return "", err
+	}
+	return formatVariableValue(v), nil
+}
+
+/*
+Lookup 変数を型を保ったまま解決.
+解決順序はResolveと同じ.
+スカラー値は string, float64, bool、Mapは map[string]any、リストは []any となる.
+*/
+func Lookup(gc GlobalContext, sc ScenarioContext, target string) (any, error) {
+	segments, err := parseVariablePath(target)
+	if err != nil {
+		return nil, fmt.Errorf("can not resolve target. target : %s. %w", target, err)
+	}
+	return lookupVariable(gc, sc, target, segments)
+}
+
+/*
+lookupVariable
+解析済みの変数パスで変数を解決.
+*/
+func lookupVariable(gc GlobalContext, sc ScenarioContext, target string, segments []variablePathSegment) (any, error) {
+	if 1 < len(segments) && !segments[0].isIndex {
+		switch segments[0].key {
+		case ScopeNameProfile:
 			// Profile変数から解決する
-			for _, v := range gc.profile.Variables {
-				if v.Key == targetArray[1] {
-					return v.Value, nil
-				}
-			}
-		} else if ScopeNameStore == targetArray[0] {
+			slog.Debug("epion-t3: try resolve scope variable.", "scope", ScopeNameProfile, "target", target)
+			return lookupScope(target, func() (any, error) { return gc.profile.lookup(segments[1:]) })
+		case ScopeNameStore:
 			// Store変数から解決する
-			for k, v := range sc.Store.Variables {
-				if k == targetArray[1] {
-					return v, nil
+			slog.Debug("epion-t3: try resolve scope variable.", "scope", ScopeNameStore, "target", target)
+			return lookupScope(target, func() (any, error) { return sc.Store().lookup(segments[1:]) })
+		case ScopeNameGlobal:
+			// Global変数から解決する
+			slog.Debug("epion-t3: try resolve scope variable.", "scope", ScopeNameGlobal, "target", target)
+			return lookupScope(target, func() (any, error) { return gc.GlobalStore().lookup(segments[1:]) })
+		case ScopeNameData:
+			// データ行から解決する
+			slog.Debug("epion-t3: try resolve scope variable.", "scope", ScopeNameData, "target", target)
+			return lookupScope(target, func() (any, error) {
+				if sc.data == nil {
+					return nil, fmt.Errorf("scenario has no data row")
 				}
-			}
+				return sc.data.lookup(segments[1:])
+			})
 		}
 	}
-	// 見つからない場合は、空文字+エラーを変役
-	return "", fmt.Errorf("can not resolve target. target : %s", target)
+
+	slog.Debug("epion-t3: try resolve from all scope variable.", "target", target)
+	if _, ok := gc.profile.Get(segments[0].key); ok {
+		return lookupScope(target, func() (any, error) { return gc.profile.lookup(segments) })
+	}
+	if _, ok := sc.Store().Get(segments[0].key); ok {
+		return lookupScope(target, func() (any, error) { return sc.Store().lookup(segments) })
+	}
+	if _, ok := gc.GlobalStore().Get(segments[0].key); ok {
+		return lookupScope(target, func() (any, error) { return gc.GlobalStore().lookup(segments) })
+	}
+	if _, ok := sc.data.value(segments[0].key); ok {
+		return lookupScope(target, func() (any, error) { return sc.data.lookup(segments) })
+	}
+	// 見つからない場合は、エラーを返却
+	return nil, fmt.Errorf("can not resolve target. target : %s", target)
+}
+
+/*
+lookupScope
+スコープ内の変数を解決し、失敗した場合は対象を含むエラーとする.
+*/
+func lookupScope(target string, lookup func() (any, error)) (any, error) {
+	v, err := lookup()
+	if err != nil {
+		return nil, fmt.Errorf("can not resolve target. target : %s. %w", target, err)
+	}
+	return v, nil
+}
+
+/*
+ReplaceMode 未解決の変数がある場合の置換モード.
+*/
+type ReplaceMode string
+
+const (
+	// ReplaceStrict 未解決の変数がある場合はエラーとする（デフォルト）
+	ReplaceStrict = ReplaceMode("strict")
+	// ReplaceLenient 未解決の変数は置換せずにそのまま残す
+	ReplaceLenient = ReplaceMode("lenient")
+)
+
+/*
+UnresolvedVariable
+解決できなかった変数.
+*/
+type UnresolvedVariable struct {
+	// ${...} を含む変数の記述
+	Expression string
+	// 置換対象文字列中の位置（バイト）
+	Position int
+	Err      error
+}
+
+func (v UnresolvedVariable) Error() string {
+	return fmt.Sprintf("%s at %d: %v", v.Expression, v.Position, v.Err)
+}
+
+func (v UnresolvedVariable) Unwrap() error {
+	return v.Err
+}
+
+/*
+UnresolvedVariablesError
+置換対象文字列中で解決できなかった全ての変数.
+*/
+type UnresolvedVariablesError struct {
+	Target    string
+	Variables []UnresolvedVariable
+}
+
+func (e *UnresolvedVariablesError) Error() string {
+	messages := make([]string, 0, len(e.Variables)+1)
+	messages = append(messages, fmt.Sprintf("can not resolve %d variables. target : %s", len(e.Variables), e.Target))
+	for _, v := range e.Variables {
+		messages = append(messages, v.Error())
+	}
+	return strings.Join(messages, "\n  ")
+}
+
+func (e *UnresolvedVariablesError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Variables))
+	for _, v := range e.Variables {
+		errs = append(errs, v)
+	}
+	return errs
+}
+
+/*
+VariableCycleError
+変数値が循環して参照されている.
+*/
+type VariableCycleError struct {
+	Chain []string
+}
+
+func (e *VariableCycleError) Error() string {
+	return "variable reference cycle detected. " + strings.Join(e.Chain, " -> ")
 }
 
 /*
 Replace 変数の置換処理.
-引数で与えられた文字列から ${スコープ.変数名} 部分を全て置換する.
+引数で与えられた文字列から ${スコープ.変数名} や ${変数式} 部分を全て置換する.
+置換モードはOptions.ReplaceModeに従う.
 */
 func Replace(gc GlobalContext, sc ScenarioContext, target string) (string, error) {
-	fss := re.FindStringSubmatch(target)
-	if 0 != len(fss) {
-		v, err := Resolve(gc, sc, fss[1])
+	return ReplaceWithMode(gc, sc, target, gc.options.ReplaceMode)
+}
+
+/*
+ReplaceWithMode 置換モードを指定して変数の置換処理.
+置換対象文字列は先頭から1度だけ走査し、置換後の値は再走査しない.
+変数値に含まれる変数は値毎に解決し、循環して参照している場合はエラーとする.
+$${ は変数ではなく ${ という文字列として扱う.
+未解決の変数はそのまま残し、ReplaceStrictの場合は全ての未解決の変数をまとめたエラーを返却する.
+*/
+func ReplaceWithMode(gc GlobalContext, sc ScenarioContext, target string, mode ReplaceMode) (string, error) {
+	r := variableReplacer{gc: gc, sc: sc, mode: mode}
+	return r.replace(target, nil)
+}
+
+/*
+variableReplacer
+変数の置換処理.
+*/
+type variableReplacer struct {
+	gc   GlobalContext
+	sc   ScenarioContext
+	mode ReplaceMode
+}
+
+/*
+replace
+置換対象文字列中の変数を置換する.
+chainは変数値の解決中である変数式（循環の検出用）.
+*/
+func (r variableReplacer) replace(target string, chain []string) (string, error) {
+	t := compileVariableTemplate(target)
+	if !t.hasVariable {
+		return t.text, nil
+	}
+	var b strings.Builder
+	b.Grow(len(target))
+	var unresolved []UnresolvedVariable
+	for _, segment := range t.segments {
+		if "" == segment.raw {
+			b.WriteString(segment.text)
+			continue
+		}
+		v, err := r.resolve(segment, chain)
 		if err != nil {
-			return target, err
+			unresolved = append(unresolved, UnresolvedVariable{Expression: segment.raw, Position: segment.position, Err: err})
+			v = segment.raw
+		}
+		b.WriteString(v)
+	}
+	if 0 == len(unresolved) {
+		return b.String(), nil
+	}
+	err := &UnresolvedVariablesError{Target: target, Variables: unresolved}
+	if ReplaceLenient == r.mode {
+		slog.Warn("unresolved variables are left as is.", "error", err)
+		return b.String(), nil
+	}
+	return b.String(), err
+}
+
+/*
+replaceValue
+置換対象文字列全体が1つの変数の場合は、変数の値を型を保ったまま返却する.
+それ以外の場合はreplaceと同じ.
+*/
+func (r variableReplacer) replaceValue(target string) (any, error) {
+	t := compileVariableTemplate(target)
+	if 1 != len(t.segments) || "" == t.segments[0].raw {
+		return r.replace(target, nil)
+	}
+	segment := t.segments[0]
+	v, err := r.resolveValue(segment, nil)
+	if err == nil {
+		return v, nil
+	}
+	err = &UnresolvedVariablesError{
+		Target:    target,
+		Variables: []UnresolvedVariable{{Expression: segment.raw, Position: segment.position, Err: err}},
+	}
+	if ReplaceLenient == r.mode {
+		slog.Warn("unresolved variables are left as is.", "error", err)
+		return target, nil
+	}
+	return target, err
+}
+
+/*
+resolve
+変数式を評価し、値に含まれる変数を置換する.
+*/
+func (r variableReplacer) resolve(segment templateSegment, chain []string) (string, error) {
+	v, err := r.resolveValue(segment, chain)
+	if err != nil {
+		return "", err
+	}
+	return formatVariableValue(v), nil
+}
+
+/*
+resolveValue
+変数式を評価し、文字列の値に含まれる変数を置換する.
+*/
+func (r variableReplacer) resolveValue(segment templateSegment, chain []string) (any, error) {
+	if segment.err != nil {
+		return nil, segment.err
+	}
+	for _, v := range chain {
+		if v == segment.source {
+			return nil, &VariableCycleError{Chain: append(append([]string{}, chain...), segment.source)}
 		}
-		target = strings.Replace(target, fss[0], v, -1)
-		fss = re.FindStringSubmatch(target)
-		if 0 != len(fss) {
-			return Replace(gc, sc, target)
-		} else {
-			return target, nil
+	}
+	v, err := segment.expression.evaluate(r.gc, r.sc)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := v.(string)
+	if !ok || !strings.Contains(s, "${") {
+		return v, nil
+	}
+	// 変数値に含まれる変数を解決する
+	return r.replace(s, append(append([]string{}, chain...), segment.source))
+}
+
+/*
+variableEnd
+${ に対応する } の位置を取得.
+文字列リテラル中や入れ子の {} は無視する.
+対応する } がない場合は-1.
+*/
+func variableEnd(target string, start int) int {
+	depth := 0
+	var quote byte
+	for i := start; i < len(target); i++ {
+		c := target[i]
+		switch {
+		case 0 != quote:
+			if '\\' == c && '"' == quote {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case '\'' == c || '"' == c:
+			quote = c
+		case '{' == c:
+			depth++
+		case '}' == c:
+			if 0 == depth {
+				return i
+			}
+			depth--
 		}
 	}
-	return target, nil
+	return -1
 }
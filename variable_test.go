@@ -1,6 +1,11 @@
 package ettt
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
 
 /*
 TestReplaceSuccess Replace関数の正常系
@@ -82,3 +87,252 @@ func TestReplaceSuccess(t *testing.T) {
 		}
 	})
 }
+
+/*
+TestReplaceStoreAndGlobal Store変数・Global変数による置換
+*/
+func TestReplaceStoreAndGlobal(t *testing.T) {
+	var gc = GlobalContext{
+		globalStore: NewStoreVariables(),
+	}
+	var sc = ScenarioContext{}
+	sc.Store().PutString("key1", "value1")
+	sc.Store().PutNumber("count", 3)
+	gc.GlobalStore().PutBool("flag", true)
+	gc.GlobalStore().Put("user", map[string]any{"name": "alice"})
+
+	result, err := Replace(gc, sc, "${store.key1}-${count}-${global.flag}-${user}")
+	if err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+	if result != `value1-3-true-{"name":"alice"}` {
+		t.Fatalf("failed test %s", result)
+	}
+	if _, err := Replace(gc, sc, "${global.key1}"); err == nil {
+		t.Fatal("failed test")
+	}
+}
+
+/*
+TestReplaceNestedPath 変数パスによる入れ子の値の置換
+*/
+func TestReplaceNestedPath(t *testing.T) {
+	var gc = GlobalContext{
+		profile: Profile{Variables: []ProfileVariable{{
+			Key:   "users",
+			Value: `[{"name":"alice"},{"name":"bob"}]`,
+			Data:  []any{map[string]any{"name": "alice"}, map[string]any{"name": "bob"}},
+		}}},
+		globalStore: NewStoreVariables(),
+	}
+	var sc = ScenarioContext{}
+	if err := sc.Store().PutJSON("response", []byte(`{"items":[{"id":10,"ok":true}],"meta":{"total":1}}`)); err != nil {
+		t.Fatalf("failed test %#v", err)
+	}
+
+	t.Run("スコープ指定のパス", func(t *testing.T) {
+		result, err := Replace(gc, sc, "${profile.users[1].name}:${store.response.items[0].id}:${store.response.items[-1].ok}")
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if result != "bob:10:true" {
+			t.Fatalf("failed test %s", result)
+		}
+	})
+	t.Run("スコープ指定なしのパスとMapのJSON変換", func(t *testing.T) {
+		result, err := Replace(gc, sc, "${users[0].name}-${response.meta}")
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if result != `alice-{"total":1}` {
+			t.Fatalf("failed test %s", result)
+		}
+	})
+	t.Run("型を保った解決", func(t *testing.T) {
+		v, err := Lookup(gc, sc, "store.response.items[0].id")
+		if err != nil || float64(10) != v {
+			t.Fatalf("failed test %#v %#v", v, err)
+		}
+	})
+	t.Run("存在しないパス", func(t *testing.T) {
+		for _, target := range []string{"${profile.users[5].name}", "${store.response.items.id}", "${users[}"} {
+			if _, err := Replace(gc, sc, target); err == nil {
+				t.Fatalf("failed test %s", target)
+			}
+		}
+	})
+}
+
+/*
+TestReplaceRobust 循環参照・エスケープ・未解決の変数の扱い
+*/
+func TestReplaceRobust(t *testing.T) {
+	var gc = GlobalContext{
+		profile: Profile{Variables: []ProfileVariable{
+			{Key: "a", Value: "A${profile.b}"},
+			{Key: "b", Value: "B${profile.a}"},
+			{Key: "self", Value: "${self}"},
+			{Key: "template", Value: "$${profile.a}"},
+			{Key: "host", Value: "example.com"},
+		}},
+		globalStore: NewStoreVariables(),
+	}
+	var sc = ScenarioContext{}
+
+	t.Run("循環参照は経路を含むエラー", func(t *testing.T) {
+		_, err := Replace(gc, sc, "${profile.a}")
+		var cycle *VariableCycleError
+		if !errors.As(err, &cycle) || "profile.a -> profile.b -> profile.a" != strings.Join(cycle.Chain, " -> ") {
+			t.Fatalf("failed test %#v", err)
+		}
+		if _, err := Replace(gc, sc, "${self}"); !errors.As(err, &cycle) {
+			t.Fatalf("failed test %#v", err)
+		}
+	})
+	t.Run("エスケープ", func(t *testing.T) {
+		result, err := Replace(gc, sc, "$${profile.host}=${profile.host}/${profile.template}")
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if result != "${profile.host}=example.com/${profile.a}" {
+			t.Fatalf("failed test %s", result)
+		}
+	})
+	t.Run("置換後の値は再走査しない", func(t *testing.T) {
+		sc := ScenarioContext{}
+		sc.Store().PutString("escaped", "$${x}")
+		result, err := Replace(gc, sc, "${store.escaped}")
+		if err != nil || result != "${x}" {
+			t.Fatalf("failed test %s %#v", result, err)
+		}
+	})
+	t.Run("全ての未解決の変数を位置と共に返却", func(t *testing.T) {
+		result, err := Replace(gc, sc, "${x}-${profile.host}-${y:-}-${ z }")
+		var unresolved *UnresolvedVariablesError
+		if !errors.As(err, &unresolved) || 2 != len(unresolved.Variables) {
+			t.Fatalf("failed test %#v", err)
+		}
+		if "${x}" != unresolved.Variables[0].Expression || 0 != unresolved.Variables[0].Position ||
+			"${ z }" != unresolved.Variables[1].Expression || 28 != unresolved.Variables[1].Position {
+			t.Fatalf("failed test %#v", unresolved.Variables)
+		}
+		if result != "${x}-example.com--${ z }" {
+			t.Fatalf("failed test %s", result)
+		}
+	})
+	t.Run("閉じられていない変数", func(t *testing.T) {
+		if _, err := Replace(gc, sc, "abc${profile.host"); err == nil {
+			t.Fatal("failed test")
+		}
+	})
+	t.Run("lenientモードは未解決の変数を残す", func(t *testing.T) {
+		result, err := ReplaceWithMode(gc, sc, "${x}-${profile.host}-${profile.a}", ReplaceLenient)
+		if err != nil {
+			t.Fatalf("failed test %#v", err)
+		}
+		if !strings.HasPrefix(result, "${x}-example.com-A") {
+			t.Fatalf("failed test %s", result)
+		}
+	})
+	t.Run("キャッシュが上限に達しても新しい置換対象文字列をキャッシュする", func(t *testing.T) {
+		for i := 0; i <= variableTemplateCacheSize; i++ {
+			compileVariableTemplate(fmt.Sprintf("${profile.host}-%d", i))
+		}
+		target := "${profile.host}-latest"
+		if compileVariableTemplate(target) != compileVariableTemplate(target) {
+			t.Fatal("failed test")
+		}
+		variableTemplateCache.mu.RLock()
+		defer variableTemplateCache.mu.RUnlock()
+		if variableTemplateCacheSize < len(variableTemplateCache.templates) || variableTemplateCacheBytes < variableTemplateCache.bytes {
+			t.Fatalf("failed test %d %d", len(variableTemplateCache.templates), variableTemplateCache.bytes)
+		}
+	})
+	t.Run("変数を含まない文字列と大きな文字列はキャッシュしない", func(t *testing.T) {
+		plain := "rendered body without variables"
+		large := "${profile.host}" + strings.Repeat("x", variableTemplateCacheMaxTarget)
+		for _, target := range []string{plain, large} {
+			if result, err := Replace(gc, sc, target); err != nil || "" == result {
+				t.Fatalf("failed test %#v", err)
+			}
+		}
+		variableTemplateCache.mu.RLock()
+		defer variableTemplateCache.mu.RUnlock()
+		if _, ok := variableTemplateCache.templates[plain]; ok {
+			t.Fatal("failed test")
+		}
+		if _, ok := variableTemplateCache.templates[large]; ok {
+			t.Fatal("failed test")
+		}
+	})
+	t.Run("文字列リテラル中の}は変数の終端としない", func(t *testing.T) {
+		result, err := Replace(gc, sc, "${y:-'{}'}")
+		if err != nil || result != "{}" {
+			t.Fatalf("failed test %s %#v", result, err)
+		}
+	})
+}
+
+/*
+benchmarkPayload
+プレースホルダをn個含むJSONのリクエストボディと、解決に必要な変数を作成する.
+*/
+func benchmarkPayload(n int) (GlobalContext, ScenarioContext, string) {
+	var profile Profile
+	for i := 0; i < n; i++ {
+		profile.override(ProfileVariable{Key: fmt.Sprintf("key%d", i), Value: fmt.Sprintf("value%d", i)})
+	}
+	var gc = GlobalContext{profile: profile, globalStore: NewStoreVariables()}
+	var sc = ScenarioContext{}
+	var b strings.Builder
+	b.WriteString("{")
+	for i := 0; i < n; i++ {
+		sc.Store().PutNumber(fmt.Sprintf("num%d", i), float64(i))
+		if 0 < i {
+			b.WriteString(",")
+		}
+		// プレースホルダ以外の文字列を含めて数KB〜数百KBのペイロードとする
+		fmt.Fprintf(&b, `"field%d":{"name":"${profile.key%d}","count":${num%d},"note":"lorem ipsum dolor sit amet"}`, i, i, i/2)
+	}
+	b.WriteString("}")
+	return gc, sc, b.String()
+}
+
+/*
+BenchmarkReplace プレースホルダ数に対して線形時間で置換できること.
+ns/op をプレースホルダ数で割った値（ns/placeholder）がほぼ一定となる.
+*/
+func BenchmarkReplace(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		gc, sc, payload := benchmarkPayload(n)
+		b.Run(fmt.Sprintf("placeholders=%d", 2*n), func(b *testing.B) {
+			if _, err := Replace(gc, sc, payload); err != nil {
+				b.Fatalf("failed test %#v", err)
+			}
+			b.SetBytes(int64(len(payload)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := Replace(gc, sc, payload); err != nil {
+					b.Fatalf("failed test %#v", err)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/float64(2*n), "ns/placeholder")
+		})
+	}
+}
+
+/*
+BenchmarkCompileVariableTemplate キャッシュを利用しない置換対象文字列の解析
+*/
+func BenchmarkCompileVariableTemplate(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		_, _, payload := benchmarkPayload(n)
+		b.Run(fmt.Sprintf("placeholders=%d", 2*n), func(b *testing.B) {
+			b.SetBytes(int64(len(payload)))
+			for i := 0; i < b.N; i++ {
+				parseVariableTemplate(payload)
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/float64(2*n), "ns/placeholder")
+		})
+	}
+}
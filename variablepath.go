@@ -0,0 +1,218 @@
+package ettt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/*
+variablePathSegment
+変数パスの要素.
+*/
+type variablePathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func (s variablePathSegment) String() string {
+	if s.isIndex {
+		return fmt.Sprintf("[%d]", s.index)
+	}
+	return s.key
+}
+
+/*
+parseVariablePath
+変数パス文字列を要素に分解.
+対応する構文は以下の通り.
+
+	name         変数名・オブジェクトのキー
+	.name        オブジェクトのキー
+	['name']     オブジェクトのキー（記号を含む場合）
+	[0] / [-1]   配列のインデックス（負数は末尾から）
+*/
+func parseVariablePath(path string) ([]variablePathSegment, error) {
+	var segments []variablePathSegment
+	rest := path
+	for first := true; "" != rest; first = false {
+		switch {
+		case '[' == rest[0]:
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed bracket in variable path. path : %s", path)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, variablePathSegment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			i, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index [%s] in variable path. path : %s", inner, path)
+			}
+			segments = append(segments, variablePathSegment{index: i, isIndex: true})
+		case '.' == rest[0] || first:
+			if !first {
+				rest = rest[1:]
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := strings.TrimSpace(rest[:end])
+			if "" == key {
+				return nil, fmt.Errorf("empty key in variable path. path : %s", path)
+			}
+			segments = append(segments, variablePathSegment{key: key})
+			rest = rest[end:]
+		default:
+			return nil, fmt.Errorf("unexpected character %q in variable path. path : %s", rest[0], path)
+		}
+	}
+	if 0 == len(segments) {
+		return nil, fmt.Errorf("empty variable path")
+	}
+	return segments, nil
+}
+
+/*
+lookupVariablePath
+構造化された値から変数パスの要素を順に辿って値を取得.
+*/
+func lookupVariablePath(value any, segments []variablePathSegment) (any, error) {
+	for _, s := range segments {
+		if s.isIndex {
+			array, ok := value.([]any)
+			if !ok {
+				return nil, fmt.Errorf("index %s target is not list", s)
+			}
+			i := s.index
+			if i < 0 {
+				i += len(array)
+			}
+			if i < 0 || i >= len(array) {
+				return nil, fmt.Errorf("index %s out of range. length : %d", s, len(array))
+			}
+			value = array[i]
+			continue
+		}
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("key %s target is not map", s)
+		}
+		if value, ok = object[s.key]; !ok {
+			return nil, fmt.Errorf("key %s not found", s)
+		}
+	}
+	return value, nil
+}
+
+/*
+normalizeVariableValue
+YAMLなどからデコードした値を、Store変数のJSON型と同じ形式
+（map[string]any, []any, string, float64, bool, nil）に変換する.
+*/
+func normalizeVariableValue(value any) any {
+	switch v := value.(type) {
+	case nil, string, bool, float64:
+		return v
+	case map[string]any:
+		normalized := make(map[string]any, len(v))
+		for k, e := range v {
+			normalized[k] = normalizeVariableValue(e)
+		}
+		return normalized
+	case map[any]any:
+		normalized := make(map[string]any, len(v))
+		for k, e := range v {
+			normalized[fmt.Sprint(k)] = normalizeVariableValue(e)
+		}
+		return normalized
+	case []any:
+		normalized := make([]any, 0, len(v))
+		for _, e := range v {
+			normalized = append(normalized, normalizeVariableValue(e))
+		}
+		return normalized
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	}
+	return fmt.Sprint(value)
+}
+
+/*
+formatVariableValue
+変数の値を文字列に変換.
+スカラー値はそのまま文字列に、Map・リストはJSON文字列に変換する.
+*/
+func formatVariableValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
+
+/*
+variableNumber
+変数の値を数値に変換.
+文字列の場合は数値として解析できれば変換する.
+*/
+func variableNumber(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("value is not number. value : %s", formatVariableValue(value))
+}
+
+/*
+variableBool
+変数の値を真偽値に変換.
+文字列の場合は真偽値として解析できれば変換する.
+*/
+func variableBool(value any) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(v)
+	}
+	return false, fmt.Errorf("value is not bool. value : %s", formatVariableValue(value))
+}
+
+/*
+decodeVariableValue
+変数の値を指定した構造体に変換.
+*/
+func decodeVariableValue(value any, out any) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
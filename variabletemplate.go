@@ -0,0 +1,154 @@
+package ettt
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+const (
+	// キャッシュする置換対象文字列の上限数.
+	// データ駆動のシナリオなどで置換対象文字列が際限なく増える場合に備える.
+	variableTemplateCacheSize = 4096
+	// キャッシュする置換対象文字列の合計サイズ（バイト）の上限.
+	variableTemplateCacheBytes = 4 << 20
+	// キャッシュする置換対象文字列1件のサイズ（バイト）の上限. 超える場合はキャッシュしない.
+	variableTemplateCacheMaxTarget = 64 << 10
+)
+
+/*
+コンパイル済みの置換対象文字列のキャッシュ.
+上限数・合計サイズの上限に達した場合はキャッシュを全て破棄してから登録する.
+*/
+var variableTemplateCache = struct {
+	mu        sync.RWMutex
+	templates map[string]*variableTemplate
+	// キャッシュしている置換対象文字列の合計サイズ
+	bytes int
+}{templates: make(map[string]*variableTemplate)}
+
+/*
+variableTemplate
+置換対象文字列を文字列と変数式の要素に分解したもの.
+*/
+type variableTemplate struct {
+	segments []templateSegment
+	// 変数を含むか
+	hasVariable bool
+	// 変数を含まない場合の文字列（エスケープ解除済み）
+	text string
+}
+
+/*
+templateSegment
+置換対象文字列の要素. rawが空の場合は文字列、それ以外は変数.
+*/
+type templateSegment struct {
+	// 文字列（エスケープ解除済み）
+	text string
+	// ${...} を含む変数の記述
+	raw string
+	// ${ と } を除いた変数式（循環の検出に利用）
+	source string
+	// 置換対象文字列中の位置（バイト）
+	position   int
+	expression variableExpression
+	// 変数式の解析エラー
+	err error
+}
+
+/*
+compileVariableTemplate
+置換対象文字列をコンパイルする.
+同じ置換対象文字列は一度だけ解析し、結果をキャッシュする.
+変数を含まない文字列（描画済みのテンプレートやリクエストボディなど）と、大きな文字列はキャッシュしない.
+キャッシュが上限に達した場合は破棄して作り直す（LRUより単純で、参照時のロックが読み取りのみで済む）.
+*/
+func compileVariableTemplate(target string) *variableTemplate {
+	if !strings.Contains(target, "${") || variableTemplateCacheMaxTarget < len(target) {
+		return parseVariableTemplate(target)
+	}
+	variableTemplateCache.mu.RLock()
+	t, ok := variableTemplateCache.templates[target]
+	variableTemplateCache.mu.RUnlock()
+	if ok {
+		return t
+	}
+	t = parseVariableTemplate(target)
+	variableTemplateCache.mu.Lock()
+	if _, ok := variableTemplateCache.templates[target]; !ok {
+		if variableTemplateCacheSize <= len(variableTemplateCache.templates) ||
+			variableTemplateCacheBytes < variableTemplateCache.bytes+len(target) {
+			clear(variableTemplateCache.templates)
+			variableTemplateCache.bytes = 0
+		}
+		variableTemplateCache.templates[target] = t
+		variableTemplateCache.bytes += len(target)
+	}
+	variableTemplateCache.mu.Unlock()
+	return t
+}
+
+/*
+parseVariableTemplate
+置換対象文字列を先頭から1度だけ走査して要素に分解する.
+$${ は ${ という文字列として扱う.
+*/
+func parseVariableTemplate(target string) *variableTemplate {
+	t := &variableTemplate{}
+	if n := strings.Count(target, "${"); 0 < n {
+		t.segments = make([]templateSegment, 0, 2*n+1)
+	}
+	var text strings.Builder
+	flush := func() {
+		if 0 < text.Len() {
+			t.segments = append(t.segments, templateSegment{text: text.String()})
+			text.Reset()
+		}
+	}
+	for i := 0; i < len(target); {
+		j := strings.IndexByte(target[i:], '$')
+		if j < 0 {
+			text.WriteString(target[i:])
+			break
+		}
+		text.WriteString(target[i : i+j])
+		i += j
+		switch {
+		case strings.HasPrefix(target[i:], "$${"):
+			text.WriteString("${")
+			i += 3
+		case strings.HasPrefix(target[i:], "${"):
+			flush()
+			t.hasVariable = true
+			end := variableEnd(target, i+2)
+			if end < 0 {
+				t.segments = append(t.segments, templateSegment{
+					raw:      target[i:],
+					source:   target[i+2:],
+					position: i,
+					err:      errors.New("variable is not closed"),
+				})
+				i = len(target)
+				continue
+			}
+			segment := templateSegment{
+				raw:      target[i : end+1],
+				source:   strings.TrimSpace(target[i+2 : end]),
+				position: i,
+			}
+			segment.expression, segment.err = parseVariableExpression(segment.source)
+			t.segments = append(t.segments, segment)
+			i = end + 1
+		default:
+			text.WriteByte('$')
+			i++
+		}
+	}
+	if !t.hasVariable {
+		t.text = text.String()
+		return t
+	}
+	flush()
+	return t
+}